@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+)
+
+// jobConfig is the configuration of the jobs run by the coordinator.
+type jobConfig struct {
+	// workers is the number of reduce tasks, and of map tasks when the
+	// documents are split by lines.
+	workers int
+	// combine is whether the map service pre-aggregates the mappings,
+	// unless the request chooses.
+	combine bool
+	// partitioner assigns the mappings to the shuffle workers:
+	// rendezvousPartitioner or moduloPartitioner.
+	partitioner string
+	// reduceInShuffle is whether the shuffle workers reduce the groups, so
+	// that they do not come back to the coordinator.
+	reduceInShuffle bool
+
+	transport transportConfig
+	stream    streamOptions
+	retry     mapreduce.RetryPolicy
+	skew      mapreduce.SkewPolicy
+	timeouts  timeouts
+}
+
+// register registers the settings of the jobs.
+func (c *jobConfig) register(s *config.Set) {
+	s.IntVar(&c.workers, "http-workers-num", 1, 1, "number of reduce tasks, and of map tasks when splitting by lines")
+	s.Require("http-workers-num")
+	s.BoolVar(&c.combine, "map-combine", false, "pre-aggregate the mappings in the map service, unless the request chooses")
+	s.EnumVar(&c.partitioner, "shuffle-partitioner", rendezvousPartitioner, []string{rendezvousPartitioner, moduloPartitioner}, "assignment of the keys to the shuffle workers")
+	s.BoolVar(&c.reduceInShuffle, "reduce-in-shuffle", false, "reduce the groups in the shuffle workers instead of the reduce service")
+	c.transport.register(s)
+	c.stream.register(s)
+	registerRetryPolicy(s, &c.retry)
+	registerSkewPolicy(s, &c.skew)
+	c.timeouts.register(s)
+}
+
+// settings are the settings of the coordinator, loaded at startup. The jobs
+// read theirs from cfg.
+var (
+	settings = config.New("coordinator")
+	cfg      = newJobConfig(settings)
+)
+
+func newJobConfig(s *config.Set) *jobConfig {
+	c := &jobConfig{}
+	c.register(s)
+	return c
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_jobConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name: "test valid settings",
+			env:  map[string]string{"HTTP_WORKERS_NUM": "3", "MAP_COMBINE": "true", "TRANSPORT": "grpc", "REDUCE_IN_SHUFFLE": "true"},
+		},
+		{
+			name:    "test missing number of workers",
+			wantErr: "missing http-workers-num: set -http-workers-num, HTTP_WORKERS_NUM or http_workers_num in the configuration file",
+		},
+		{
+			name:    "test wrong number of workers",
+			env:     map[string]string{"HTTP_WORKERS_NUM": "3a"},
+			wantErr: "invalid HTTP_WORKERS_NUM: 3a: not an integer",
+		},
+		{
+			name:    "test wrong combiner setting",
+			env:     map[string]string{"HTTP_WORKERS_NUM": "3", "MAP_COMBINE": "sometimes"},
+			wantErr: `invalid MAP_COMBINE: sometimes: parse error`,
+		},
+		{
+			name:    "test wrong reduce in shuffle setting",
+			env:     map[string]string{"HTTP_WORKERS_NUM": "3", "REDUCE_IN_SHUFFLE": "maybe"},
+			wantErr: `invalid REDUCE_IN_SHUFFLE: maybe: parse error`,
+		},
+		{
+			name:    "test wrong transport and port",
+			env:     map[string]string{"HTTP_WORKERS_NUM": "3", "TRANSPORT": "smtp", "REDUCE_SVC_GRPC_PORT": "0"},
+			wantErr: "invalid TRANSPORT: smtp: must be one of http, grpc\ninvalid REDUCE_SVC_GRPC_PORT: 0: not a port",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"HTTP_WORKERS_NUM", "MAP_COMBINE", "TRANSPORT", "REDUCE_SVC_GRPC_PORT", "REDUCE_IN_SHUFFLE"} {
+				t.Setenv(name, tt.env[name])
+			}
+			t.Cleanup(settings.Reset)
+
+			err := settings.Load(nil)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_debugConfigHandler(t *testing.T) {
+	t.Setenv("HTTP_WORKERS_NUM", "3")
+	t.Setenv("MAP_SVC_NAME", "mapper")
+	loadSettings(t)
+
+	w := httptest.NewRecorder()
+	newMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	got := map[string]struct{ Value, Source string }{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "3", got["http-workers-num"].Value)
+	assert.Equal(t, "mapper", got["map-svc-name"].Value)
+	assert.Equal(t, "env", got["map-svc-name"].Source)
+	assert.Equal(t, "80", got["map-svc-port"].Value)
+	assert.Equal(t, "default", got["map-svc-port"].Source)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/FDeRubeis/mapreduce/internal/rpc"
+	"github.com/FDeRubeis/mapreduce/internal/server"
+)
+
+// workerChecks are the readiness checks of the coordinator: the map, shuffle
+// and reduce services resolve and answer on the port of the transport.
+var workerChecks = []server.Check{
+	{Name: "map", Check: func(ctx context.Context) error {
+		return checkWorker(ctx, cfg.transport.mapSvc.addr(cfg.transport.kind))
+	}},
+	{Name: "shuffle", Check: checkShuffleWorkers},
+	{Name: "reduce", Check: func(ctx context.Context) error {
+		return checkWorker(ctx, cfg.transport.reduceSvc.addr(cfg.transport.kind))
+	}},
+}
+
+// checkShuffleWorkers looks up the shuffle workers as a job does, and checks
+// each of them, since every worker gets a partition of the job.
+func checkShuffleWorkers(ctx context.Context) error {
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", cfg.transport.shuffleSvc.name)
+	if err != nil {
+		return err
+	}
+	if len(ips) == 0 {
+		return errors.New("no shuffle workers")
+	}
+
+	port := cfg.transport.shuffleSvc.port
+	if cfg.transport.kind == grpcTransport {
+		port = cfg.transport.shuffleSvc.grpcPort
+	}
+	for _, addr := range workerAddrs(ips, port) {
+		if err := checkWorker(ctx, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWorker checks that the worker at addr answers on /healthz, or on the
+// gRPC health service with the gRPC transport.
+func checkWorker(ctx context.Context, addr string) error {
+
+	if cfg.transport.kind == grpcTransport {
+		return rpc.NewClient(rpcDialOptions...).CheckHealth(ctx, addr)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", addr, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/rpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func Test_readiness(t *testing.T) {
+
+	// a reduce worker that is up but failing
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}))
+	defer failingServer.Close()
+
+	mapServerAddress := mapServer.Listener.Addr().(*net.TCPAddr)
+	shuffleServerAddress := shuffleServer.Listener.Addr().(*net.TCPAddr)
+	redServerAddress := reduceServer.Listener.Addr().(*net.TCPAddr)
+	failingServerAddress := failingServer.Listener.Addr().(*net.TCPAddr)
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantStatus int
+		// wantBody is the beginning of the body
+		wantBody string
+	}{
+		{
+			name:       "test ready",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok\n",
+		},
+		{
+			name:       "test unresolved shuffle service",
+			env:        map[string]string{"SHUFFLE_SVC_NAME": "shuffle.invalid."},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "shuffle: lookup shuffle.invalid.",
+		},
+		{
+			name:       "test failing reduce service",
+			env:        map[string]string{"REDUCE_SVC_PORT": strconv.Itoa(failingServerAddress.Port)},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "reduce: " + failingServerAddress.String() + " answered 500 Internal Server Error\n",
+		},
+		{
+			name:       "test unreachable map service",
+			env:        map[string]string{"MAP_SVC_NAME": "unreachable."},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "map: ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAP_SVC_NAME", mapServerAddress.IP.String())
+			t.Setenv("MAP_SVC_PORT", strconv.Itoa(mapServerAddress.Port))
+			t.Setenv("SHUFFLE_SVC_NAME", shuffleServerARecord)
+			t.Setenv("SHUFFLE_SVC_PORT", strconv.Itoa(shuffleServerAddress.Port))
+			t.Setenv("REDUCE_SVC_NAME", redServerAddress.IP.String())
+			t.Setenv("REDUCE_SVC_PORT", strconv.Itoa(redServerAddress.Port))
+			t.Setenv("HTTP_WORKERS_NUM", "3")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			loadSettings(t)
+
+			w := httptest.NewRecorder()
+			newMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Truef(t, strings.HasPrefix(w.Body.String(), tt.wantBody), "GET /readyz = %q, want prefix %q", w.Body.String(), tt.wantBody)
+
+			// liveness does not depend on the workers
+			w = httptest.NewRecorder()
+			newMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func Test_grpcReadiness(t *testing.T) {
+
+	// workers that are up on their HTTP port, which the gRPC transport does
+	// not use
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}))
+	defer failingServer.Close()
+	failingPort := strconv.Itoa(failingServer.Listener.Addr().(*net.TCPAddr).Port)
+
+	tests := []struct {
+		name       string
+		health     bool
+		wantStatus int
+		// wantBody is the beginning of the body
+		wantBody string
+	}{
+		{
+			name:       "test ready",
+			health:     true,
+			wantStatus: http.StatusOK,
+			wantBody:   "ok\n",
+		},
+		{
+			name:       "test workers without health service",
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "map: rpc error: code = Unimplemented",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// serve the workers on an in-process connection
+			lis := bufconn.Listen(1024 * 1024)
+			s := grpc.NewServer()
+			rpc.RegisterMapper(s)
+			rpc.RegisterShuffler(s)
+			rpc.RegisterReducer(s)
+			if tt.health {
+				rpc.RegisterHealth(s)
+			}
+			go s.Serve(lis)
+			defer s.Stop()
+
+			rpcDialOptions = []grpc.DialOption{grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			})}
+			defer func() { rpcDialOptions = nil }()
+
+			t.Setenv("TRANSPORT", "grpc")
+			t.Setenv("HTTP_WORKERS_NUM", "3")
+			t.Setenv("MAP_SVC_NAME", "127.0.0.1")
+			t.Setenv("MAP_SVC_PORT", failingPort)
+			t.Setenv("SHUFFLE_SVC_NAME", shuffleServerARecord)
+			t.Setenv("SHUFFLE_SVC_PORT", failingPort)
+			t.Setenv("REDUCE_SVC_NAME", "127.0.0.1")
+			t.Setenv("REDUCE_SVC_PORT", failingPort)
+			loadSettings(t)
+
+			w := httptest.NewRecorder()
+			newMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Truef(t, strings.HasPrefix(w.Body.String(), tt.wantBody), "GET /readyz = %q, want prefix %q", w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func Test_metricsHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	newMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "mapreduce_mappings_total")
+}
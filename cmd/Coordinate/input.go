@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+)
+
+// split modes of the document
+const (
+	// splitBytes streams the document in tasks of about map-task-bytes bytes.
+	splitBytes = "bytes"
+	// splitLines reads the whole document and splits it in one task per
+	// worker with the same number of lines.
+	splitLines = "lines"
+)
+
+// streamOptions configure how the document is split in map tasks.
+type streamOptions struct {
+	mode string
+	// taskBytes is the maximum size of a map task in bytes mode. A task is
+	// only larger when it holds a single word longer than that.
+	taskBytes int
+	// maxInflight caps the bytes of the map tasks being processed.
+	maxInflight int
+	// spillDir is where the mappings are written until the shuffle, or empty
+	// to keep them in memory.
+	spillDir string
+}
+
+// register registers the stream options as split-mode, map-task-bytes,
+// max-inflight-bytes and spill-dir.
+func (o *streamOptions) register(s *config.Set) {
+	s.EnumVar(&o.mode, "split-mode", splitBytes, []string{splitBytes, splitLines}, "how the documents are split in map tasks")
+	s.IntVar(&o.taskBytes, "map-task-bytes", mapreduce.DefaultTaskBytes, 1, "maximum size of a map task in bytes mode")
+	s.IntVar(&o.maxInflight, "max-inflight-bytes", mapreduce.DefaultMaxInflightBytes, 1, "maximum bytes of the map tasks in flight")
+	s.StringVar(&o.spillDir, "spill-dir", os.TempDir(), "directory where the mappings are written until the shuffle, or empty to keep them in memory")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_streamOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		splitMode   string
+		taskBytes   string
+		maxInflight string
+		spillDir    string
+		want        streamOptions
+		wantErr     string
+	}{
+		{
+			name: "test defaults",
+			want: streamOptions{mode: splitBytes, taskBytes: mapreduce.DefaultTaskBytes, maxInflight: mapreduce.DefaultMaxInflightBytes, spillDir: os.TempDir()},
+		},
+		{
+			name:        "test configured options",
+			splitMode:   "lines",
+			taskBytes:   "1024",
+			maxInflight: "4096",
+			spillDir:    "/var/spill",
+			want:        streamOptions{mode: splitLines, taskBytes: 1024, maxInflight: 4096, spillDir: "/var/spill"},
+		},
+		{
+			name:      "test invalid split mode",
+			splitMode: "words",
+			wantErr:   "invalid SPLIT_MODE: words: must be one of bytes, lines",
+		},
+		{
+			name:      "test invalid task bytes",
+			taskBytes: "0",
+			wantErr:   "invalid MAP_TASK_BYTES: 0: must be at least 1",
+		},
+		{
+			name:        "test invalid max inflight",
+			maxInflight: "0",
+			wantErr:     "invalid MAX_INFLIGHT_BYTES: 0: must be at least 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SPLIT_MODE", tt.splitMode)
+			t.Setenv("MAP_TASK_BYTES", tt.taskBytes)
+			t.Setenv("MAX_INFLIGHT_BYTES", tt.maxInflight)
+			t.Setenv("SPILL_DIR", tt.spillDir)
+
+			var got streamOptions
+			s := config.New("test")
+			got.register(s)
+			err := s.Load(nil)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
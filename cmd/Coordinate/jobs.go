@@ -0,0 +1,537 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/job"
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/internal/output"
+	"github.com/FDeRubeis/mapreduce/internal/tracing"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// status of a job or of one of its phases
+const (
+	statusPending   = "pending"
+	statusRunning   = "running"
+	statusSucceeded = "succeeded"
+	statusFailed    = "failed"
+	statusTimedOut  = "timed_out"
+)
+
+// jobRetention is how long finished jobs are kept before being evicted.
+const jobRetention = time.Hour
+
+// unknownJob is the answer of the jobs API to an unknown job ID. The jobs
+// live in the memory of the coordinator, so that a job is also unknown once
+// the coordinator has restarted.
+const unknownJob = "Job not found: jobs are kept in the memory of the coordinator until one hour after they finish, and are lost when it restarts"
+
+// phaseProgress tracks the tasks of one phase (map, shuffle or reduce) of a
+// job. A nil phaseProgress ignores all updates.
+type phaseProgress struct {
+	mu         sync.Mutex
+	status     string
+	tasksDone  int
+	tasksTotal int
+}
+
+func (p *phaseProgress) start(tasks int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = statusRunning
+	p.tasksTotal = tasks
+}
+
+// addTask counts a task of a phase whose tasks are created while it runs.
+func (p *phaseProgress) addTask() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tasksTotal++
+}
+
+func (p *phaseProgress) taskDone() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tasksDone++
+}
+
+func (p *phaseProgress) finish(err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = finishedStatus(err)
+}
+
+// finishedStatus returns the status of a job or phase that finished with err.
+func finishedStatus(err error) string {
+	switch {
+	case err == nil:
+		return statusSucceeded
+	case errors.Is(err, context.DeadlineExceeded):
+		return statusTimedOut
+	default:
+		return statusFailed
+	}
+}
+
+type phaseStatus struct {
+	Status     string `json:"status"`
+	TasksDone  int    `json:"tasks_done"`
+	TasksTotal int    `json:"tasks_total"`
+}
+
+func (p *phaseProgress) snapshot() phaseStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return phaseStatus{p.status, p.tasksDone, p.tasksTotal}
+}
+
+// jobRecord is a job submitted to the coordinator.
+type jobRecord struct {
+	id      string
+	name    string
+	created time.Time
+
+	// top is the top-K query of the job, if any
+	top *job.TopK
+
+	mapProgress     phaseProgress
+	shuffleProgress phaseProgress
+	reduceProgress  phaseProgress
+
+	// uploaded is closed when the body of the job has been read, to its end
+	// or up to an error, or when the job has stopped reading it. The map
+	// tasks of the last parts of the body may still be running.
+	uploaded     chan struct{}
+	uploadedOnce sync.Once
+
+	// done is closed when the job has finished. The fields below are
+	// protected by mu.
+	done     chan struct{}
+	mu       sync.Mutex
+	status   string
+	err      error
+	finished time.Time
+	result   map[string]json.RawMessage
+
+	// sorted are the rows of the result, by order, so that the pages of a
+	// result are not sorted again. They are protected by sortedMu.
+	sortedMu sync.Mutex
+	sorted   map[string][]output.Row
+}
+
+// rows returns the rows of the result of the job in the given order, only
+// those of the top K keys for a top-K query. The rows are sorted once per
+// order and kept with the job.
+func (rec *jobRecord) rows(order string) ([]output.Row, error) {
+
+	rec.mu.Lock()
+	result := rec.result
+	rec.mu.Unlock()
+
+	rec.sortedMu.Lock()
+	defer rec.sortedMu.Unlock()
+	if rows, ok := rec.sorted[order]; ok {
+		return rows, nil
+	}
+
+	if rec.top != nil {
+		var err error
+		if result, err = rec.top.Select(result); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := output.Sort(result, order)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadView, err)
+	}
+
+	if rec.sorted == nil {
+		rec.sorted = map[string][]output.Row{}
+	}
+	rec.sorted[order] = rows
+	return rows, nil
+}
+
+type jobStatus struct {
+	ID       string     `json:"id"`
+	Job      string     `json:"job"`
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Expires is when a finished job is evicted, after which its ID is
+	// unknown.
+	Expires *time.Time             `json:"expires,omitempty"`
+	Phases  map[string]phaseStatus `json:"phases"`
+}
+
+func (rec *jobRecord) snapshot() jobStatus {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	s := jobStatus{
+		ID:      rec.id,
+		Job:     rec.name,
+		Status:  rec.status,
+		Created: rec.created,
+		Phases: map[string]phaseStatus{
+			"map":     rec.mapProgress.snapshot(),
+			"shuffle": rec.shuffleProgress.snapshot(),
+			"reduce":  rec.reduceProgress.snapshot(),
+		},
+	}
+	if rec.err != nil {
+		s.Error = rec.err.Error()
+	}
+	if !rec.finished.IsZero() {
+		finished := rec.finished
+		expires := finished.Add(jobRetention)
+		s.Finished = &finished
+		s.Expires = &expires
+	}
+	return s
+}
+
+func (rec *jobRecord) setStatus(status string, err error, result map[string]json.RawMessage) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.status = status
+	rec.err = err
+	rec.result = result
+	if status == statusSucceeded || status == statusFailed || status == statusTimedOut {
+		rec.finished = time.Now()
+		close(rec.done)
+	}
+}
+
+// jobStore keeps the jobs submitted to the coordinator.
+type jobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*jobRecord
+	// running counts the jobs that have not finished yet
+	running sync.WaitGroup
+}
+
+var jobs = &jobStore{jobs: map[string]*jobRecord{}}
+
+// submit registers a new job and starts running it in the background with
+// the engine. Canceling ctx cancels the job.
+func (s *jobStore) submit(ctx context.Context, j *job.Job, input io.Reader, engine *mapreduce.Engine, top *job.TopK) (*jobRecord, error) {
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	rec := &jobRecord{
+		id:              hex.EncodeToString(id),
+		name:            j.Name,
+		top:             top,
+		created:         time.Now(),
+		uploaded:        make(chan struct{}),
+		done:            make(chan struct{}),
+		status:          statusPending,
+		mapProgress:     phaseProgress{status: statusPending},
+		shuffleProgress: phaseProgress{status: statusPending},
+		reduceProgress:  phaseProgress{status: statusPending},
+	}
+
+	s.mu.Lock()
+	s.evict(rec.created)
+	s.jobs[rec.id] = rec
+	s.mu.Unlock()
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		runJob(ctx, rec, j, input, engine)
+	}()
+
+	return rec, nil
+}
+
+// wait waits for the running jobs to finish, or for ctx to be done.
+func (s *jobStore) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// evict removes the jobs that finished more than jobRetention before now.
+// The caller must hold s.mu.
+func (s *jobStore) evict(now time.Time) {
+	for id, rec := range s.jobs {
+		rec.mu.Lock()
+		expired := !rec.finished.IsZero() && now.Sub(rec.finished) > jobRetention
+		rec.mu.Unlock()
+		if expired {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *jobStore) get(id string) (*jobRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.jobs[id]
+	return rec, ok
+}
+
+// runJob runs the map, shuffle and reduce phases of a job.
+func runJob(ctx context.Context, rec *jobRecord, j *job.Job, input io.Reader, engine *mapreduce.Engine) {
+
+	defer rec.closeUploaded()
+	input = &uploadReader{r: input, done: rec.closeUploaded}
+	rec.setStatus(statusRunning, nil, nil)
+
+	// the engine sends the ID to the workers, which log it with the tasks
+	engine.JobID = rec.id
+	logger := log.WithField(logging.JobField, rec.id)
+
+	ctx, span := tracing.Start(ctx, "run job", trace.WithAttributes(attribute.String("mapreduce.job.id", rec.id)))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	// nslookup shuffle hosts
+	lookupCtx, lookupSpan := tracing.Start(ctx, "lookup shuffle workers")
+	shufflers, err := lookupShuffleWorkers(lookupCtx, net.DefaultResolver, cfg.transport.shuffleSvc.name)
+	lookupSpan.SetAttributes(attribute.Int("mapreduce.shuffle.workers", len(shufflers)))
+	tracing.End(lookupSpan, err)
+	if err != nil {
+		logger.Errorf("Error finding the workers: %s", err)
+		rec.setStatus(statusFailed, err, nil)
+		return
+	}
+	engine.ShuffleTasks = len(shufflers)
+	engine.Partitioner = shufflers.partitioner(cfg.partitioner)
+	engine.Transport = cfg.transport.transport(shufflers.ips())
+
+	engine.Progress = rec
+	result, err := engine.Run(ctx, j, input)
+	if err != nil {
+		logger.Errorf("Job %s failed: %s", rec.id, err)
+		rec.setStatus(finishedStatus(err), err, nil)
+		return
+	}
+
+	rec.setStatus(statusSucceeded, nil, result)
+	logger.Infof("Successfully ran %s job %s", rec.name, rec.id)
+}
+
+// progress returns the progress of a phase of the job.
+func (rec *jobRecord) progress(phase mapreduce.Phase) *phaseProgress {
+	switch phase {
+	case mapreduce.MapPhase:
+		return &rec.mapProgress
+	case mapreduce.ShufflePhase:
+		return &rec.shuffleProgress
+	case mapreduce.ReducePhase:
+		return &rec.reduceProgress
+	}
+	return nil
+}
+
+func (rec *jobRecord) PhaseStarted(phase mapreduce.Phase, tasks int) {
+	rec.progress(phase).start(tasks)
+}
+
+func (rec *jobRecord) TaskAdded(phase mapreduce.Phase) {
+	rec.progress(phase).addTask()
+}
+
+func (rec *jobRecord) TaskDone(phase mapreduce.Phase) {
+	rec.progress(phase).taskDone()
+}
+
+func (rec *jobRecord) PhaseFinished(phase mapreduce.Phase, err error) {
+	rec.progress(phase).finish(err)
+	if phase == mapreduce.MapPhase {
+		rec.closeUploaded()
+	}
+}
+
+// closeUploaded marks the input of the job as read.
+func (rec *jobRecord) closeUploaded() {
+	rec.uploadedOnce.Do(func() { close(rec.uploaded) })
+}
+
+// uploadReader reads the body of a job and calls done once the body is over
+// or fails.
+type uploadReader struct {
+	r    io.Reader
+	done func()
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	if err != nil {
+		u.done()
+	}
+	return n, err
+}
+
+// submitRequest reads the document, the job and the number of workers of a
+// job submission, and runs the job until ctx is canceled. If the request is
+// invalid, it writes the error response and returns nil.
+func submitRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) *jobRecord {
+
+	// a draining coordinator only finishes the jobs it has
+	if service.Draining() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		log.Errorf("Rejecting job: the coordinator is shutting down")
+		return nil
+	}
+
+	params := r.URL.Query()
+	j, err := job.Lookup(params.Get("job"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		log.Errorf("Invalid job: %s", err)
+		return nil
+	}
+	params.Set("job", j.Name)
+
+	top, err := j.ParseTopK(params)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		log.Errorf("Invalid top-K query: %s", err)
+		return nil
+	}
+
+	// pre-aggregate the mappings in the map service, unless the client chose
+	if !params.Has("combine") && cfg.combine {
+		params.Set("combine", "true")
+	}
+
+	engine := &mapreduce.Engine{
+		Params:           params,
+		TaskBytes:        cfg.stream.taskBytes,
+		MaxInflightBytes: cfg.stream.maxInflight,
+		SpillDir:         cfg.stream.spillDir,
+		ReduceTasks:      cfg.workers,
+		Retry:            cfg.retry,
+		Skew:             cfg.skew,
+		ReduceInShuffle:  cfg.reduceInShuffle,
+	}
+	if cfg.stream.mode == splitLines {
+		engine.MapTasks = cfg.workers
+	}
+	cfg.timeouts.apply(engine)
+
+	rec, err := jobs.submit(ctx, j, r.Body, engine, top)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		log.Errorf("Error submitting job: %s", err)
+		return nil
+	}
+
+	return rec
+}
+
+func submitJobHandler(w http.ResponseWriter, r *http.Request) {
+
+	// the job outlives the request
+	rec := submitRequest(context.Background(), w, r)
+	if rec == nil {
+		return
+	}
+
+	// the body can only be read until the handler returns
+	<-rec.uploaded
+
+	// write response
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+rec.id)
+	w.Header().Set(logging.JobIDHeader, rec.id)
+	status_marshaled, err := json.Marshal(rec.snapshot())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		log.Errorf("Error encoding job status: %s", err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	if _, err := w.Write(status_marshaled); err != nil {
+		log.Errorf("Error writing answer: %s", err)
+		return
+	}
+
+	log.WithField(logging.JobField, rec.id).Infof("Submitted %s job %s", rec.name, rec.id)
+}
+
+func jobStatusHandler(w http.ResponseWriter, r *http.Request) {
+
+	rec, ok := jobs.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, unknownJob, http.StatusNotFound)
+		log.Errorf("Job not found: %s", r.PathValue("id"))
+		return
+	}
+
+	// write response
+	w.Header().Set("Content-Type", "application/json")
+	status_marshaled, err := json.Marshal(rec.snapshot())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		log.Errorf("Error encoding job status: %s", err)
+		return
+	}
+	if _, err := w.Write(status_marshaled); err != nil {
+		log.Errorf("Error writing answer: %s", err)
+		return
+	}
+}
+
+func jobResultHandler(w http.ResponseWriter, r *http.Request) {
+
+	rec, ok := jobs.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, unknownJob, http.StatusNotFound)
+		log.Errorf("Job not found: %s", r.PathValue("id"))
+		return
+	}
+
+	rec.mu.Lock()
+	status := rec.status
+	rec.mu.Unlock()
+	if status != statusSucceeded {
+		http.Error(w, "Job "+status, http.StatusConflict)
+		log.Errorf("Result of job %s requested while %s", rec.id, status)
+		return
+	}
+
+	writeResult(w, r, rec)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/internal/server"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_jobsAPI(t *testing.T) {
+
+	mapServerAddress := mapServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("MAP_SVC_NAME", mapServerAddress.IP.String())
+	t.Setenv("MAP_SVC_PORT", strconv.Itoa(mapServerAddress.Port))
+
+	server_address := shuffleServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("SHUFFLE_SVC_NAME", shuffleServerARecord)
+	t.Setenv("SHUFFLE_SVC_PORT", strconv.Itoa(server_address.Port))
+
+	redServerAddress := reduceServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("REDUCE_SVC_NAME", redServerAddress.IP.String())
+	t.Setenv("REDUCE_SVC_PORT", strconv.Itoa(redServerAddress.Port))
+
+	t.Setenv("HTTP_WORKERS_NUM", "3")
+
+	// the mock map server knows the lines of the documents, up to 11 bytes
+	t.Setenv("MAP_TASK_BYTES", "11")
+
+	tests := []struct {
+		name       string
+		content    string
+		jobTimeout string
+		wantStatus string
+		wantError  string
+		wantPhases map[string]string
+		wantResult map[string]int
+	}{
+		{
+			name:       "test successful job",
+			content:    "lorem lorem\nlorem ipsum\nipsum sit",
+			wantStatus: statusSucceeded,
+			wantPhases: map[string]string{
+				"map":     statusSucceeded,
+				"shuffle": statusSucceeded,
+				"reduce":  statusSucceeded,
+			},
+			wantResult: map[string]int{
+				"lorem": 3,
+				"ipsum": 2,
+				"sit":   1,
+			},
+		},
+		{
+			name:       "test failed job",
+			content:    "lorem lorem\nlorem ipsum\ngibberish",
+			wantStatus: statusFailed,
+			wantError:  "map task 2 failed after 3 attempts: invalid character 'b' looking for beginning of value",
+			wantPhases: map[string]string{
+				"map":     statusFailed,
+				"shuffle": statusPending,
+				"reduce":  statusPending,
+			},
+		},
+		{
+			name:       "test timed out job",
+			content:    "lorem lorem\nlorem ipsum\nipsum sit",
+			jobTimeout: "1ns",
+			wantStatus: statusTimedOut,
+			wantError:  "job timed out after 1ns: context deadline exceeded",
+			wantPhases: map[string]string{
+				"map":     statusTimedOut,
+				"shuffle": statusPending,
+				"reduce":  statusPending,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JOB_TIMEOUT", tt.jobTimeout)
+			loadSettings(t)
+			mux := newMux()
+
+			// submit job
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(tt.content)))
+			assert.Equalf(t, http.StatusAccepted, w.Code, "POST /jobs = %d, expected status code: %d", w.Code, http.StatusAccepted)
+
+			submitted := jobStatus{}
+			if err := json.Unmarshal(w.Body.Bytes(), &submitted); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "/jobs/"+submitted.ID, w.Header().Get("Location"))
+			assert.Equal(t, submitted.ID, w.Header().Get(logging.JobIDHeader))
+
+			// poll status until the job is finished
+			status := jobStatus{}
+			for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				w = httptest.NewRecorder()
+				mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/"+submitted.ID, nil))
+				assert.Equalf(t, http.StatusOK, w.Code, "GET /jobs/{id} = %d, expected status code: %d", w.Code, http.StatusOK)
+				if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+					t.Fatal(err)
+				}
+				if status.Finished != nil {
+					break
+				}
+			}
+			assert.Equal(t, tt.wantStatus, status.Status)
+			assert.Equal(t, tt.wantError, status.Error)
+			if assert.NotNil(t, status.Expires) {
+				assert.Equal(t, status.Finished.Add(jobRetention), *status.Expires)
+			}
+			for phase, want := range tt.wantPhases {
+				assert.Equalf(t, want, status.Phases[phase].Status, "%s phase status = %s, want %s", phase, status.Phases[phase].Status, want)
+			}
+
+			// get result
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/"+submitted.ID+"/result", nil))
+			if tt.wantStatus != statusSucceeded {
+				assert.Equalf(t, http.StatusConflict, w.Code, "GET /jobs/{id}/result = %d, expected status code: %d", w.Code, http.StatusConflict)
+				return
+			}
+			assert.Equalf(t, http.StatusOK, w.Code, "GET /jobs/{id}/result = %d, expected status code: %d", w.Code, http.StatusOK)
+			result := map[string]int{}
+			json.Unmarshal(w.Body.Bytes(), &result)
+			if !reflect.DeepEqual(result, tt.wantResult) {
+				t.Errorf("GET /jobs/{id}/result = %v, want %v", result, tt.wantResult)
+			}
+		})
+	}
+}
+
+func Test_jobsAPIUnknownJob(t *testing.T) {
+	mux := newMux()
+
+	for _, path := range []string{"/jobs/unknown", "/jobs/unknown/result"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equalf(t, http.StatusNotFound, w.Code, "GET %s = %d, expected status code: %d", path, w.Code, http.StatusNotFound)
+		assert.Equal(t, unknownJob+"\n", w.Body.String())
+	}
+}
+
+func Test_jobsAPIDraining(t *testing.T) {
+
+	mapServerAddress := mapServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("MAP_SVC_NAME", mapServerAddress.IP.String())
+	t.Setenv("MAP_SVC_PORT", strconv.Itoa(mapServerAddress.Port))
+
+	server_address := shuffleServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("SHUFFLE_SVC_NAME", shuffleServerARecord)
+	t.Setenv("SHUFFLE_SVC_PORT", strconv.Itoa(server_address.Port))
+
+	redServerAddress := reduceServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("REDUCE_SVC_NAME", redServerAddress.IP.String())
+	t.Setenv("REDUCE_SVC_PORT", strconv.Itoa(redServerAddress.Port))
+
+	t.Setenv("HTTP_WORKERS_NUM", "3")
+	t.Setenv("MAP_TASK_BYTES", "11")
+	loadSettings(t)
+
+	defer func(s *server.Service) { service = s }(service)
+	service = &server.Service{Wait: jobs.wait}
+	mux := newMux()
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equalf(t, http.StatusOK, w.Code, "GET /readyz = %d, expected status code: %d", w.Code, http.StatusOK)
+
+	// a job submitted before the drain
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")))
+	assert.Equalf(t, http.StatusAccepted, w.Code, "POST /jobs = %d, expected status code: %d", w.Code, http.StatusAccepted)
+	submitted := jobStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &submitted); err != nil {
+		t.Fatal(err)
+	}
+
+	service.Drain()
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equalf(t, http.StatusServiceUnavailable, w.Code, "GET /readyz = %d, expected status code: %d", w.Code, http.StatusServiceUnavailable)
+
+	// new jobs are rejected, synchronous or not
+	for _, path := range []string{"/", "/jobs"} {
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader("lorem")))
+		assert.Equalf(t, http.StatusServiceUnavailable, w.Code, "POST %s = %d, expected status code: %d", path, w.Code, http.StatusServiceUnavailable)
+	}
+
+	// the running job finishes
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := service.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/"+submitted.ID, nil))
+	status := jobStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, statusSucceeded, status.Status)
+}
+
+func Test_jobsAPIUploaded(t *testing.T) {
+
+	// a map server that holds the tasks until the job is submitted
+	release := make(chan struct{})
+	releaseTasks := sync.OnceFunc(func() { close(release) })
+	heldMapServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mapServerHandler(w, r)
+	}))
+	defer heldMapServer.Close()
+	defer releaseTasks()
+
+	mapServerAddress := heldMapServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("MAP_SVC_NAME", mapServerAddress.IP.String())
+	t.Setenv("MAP_SVC_PORT", strconv.Itoa(mapServerAddress.Port))
+
+	server_address := shuffleServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("SHUFFLE_SVC_NAME", shuffleServerARecord)
+	t.Setenv("SHUFFLE_SVC_PORT", strconv.Itoa(server_address.Port))
+
+	redServerAddress := reduceServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("REDUCE_SVC_NAME", redServerAddress.IP.String())
+	t.Setenv("REDUCE_SVC_PORT", strconv.Itoa(redServerAddress.Port))
+
+	t.Setenv("HTTP_WORKERS_NUM", "3")
+	t.Setenv("MAP_TASK_BYTES", "11")
+	loadSettings(t)
+	mux := newMux()
+
+	// the job is accepted once its body is read, while its map tasks run
+	w := httptest.NewRecorder()
+	submitted := make(chan struct{})
+	go func() {
+		defer close(submitted)
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")))
+	}()
+	select {
+	case <-submitted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("POST /jobs waited for the map tasks")
+	}
+	assert.Equalf(t, http.StatusAccepted, w.Code, "POST /jobs = %d, expected status code: %d", w.Code, http.StatusAccepted)
+	status := jobStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, statusRunning, status.Phases["map"].Status)
+
+	releaseTasks()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := jobs.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, _ := jobs.get(status.ID)
+	assert.Equal(t, statusSucceeded, rec.snapshot().Status)
+}
+
+func Test_jobsAPITracing(t *testing.T) {
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(provider)
+
+	mapServerAddress := mapServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("MAP_SVC_NAME", mapServerAddress.IP.String())
+	t.Setenv("MAP_SVC_PORT", strconv.Itoa(mapServerAddress.Port))
+
+	server_address := shuffleServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("SHUFFLE_SVC_NAME", shuffleServerARecord)
+	t.Setenv("SHUFFLE_SVC_PORT", strconv.Itoa(server_address.Port))
+
+	redServerAddress := reduceServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("REDUCE_SVC_NAME", redServerAddress.IP.String())
+	t.Setenv("REDUCE_SVC_PORT", strconv.Itoa(redServerAddress.Port))
+
+	t.Setenv("HTTP_WORKERS_NUM", "3")
+	t.Setenv("MAP_TASK_BYTES", "11")
+	loadSettings(t)
+
+	w := httptest.NewRecorder()
+	newMux().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the lookup of the shuffle workers and the job are children of the run
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	run := spans["run job"]
+	for _, name := range []string{"lookup shuffle workers", "job"} {
+		assert.Equalf(t, run.SpanContext.SpanID(), spans[name].Parent.SpanID(), "parent of %s span", name)
+	}
+	assert.Contains(t, spans["lookup shuffle workers"].Attributes, attribute.Int("mapreduce.shuffle.workers", 6))
+}
@@ -6,12 +6,16 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
 	"github.com/foxcpp/go-mockdns"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -22,291 +26,6 @@ var shuffleServer *httptest.Server
 var reduceServer *httptest.Server
 var shuffleServerARecord = "shuffle."
 
-func Test_partitionContent(t *testing.T) {
-	type args struct {
-		content string
-		n       int
-	}
-	tests := []struct {
-		name string
-		args args
-		want []string
-	}{
-		{
-			name: "test partition content",
-			args: args{
-				content: "lorem ipsum\ndolor sit\namet consectetur",
-				n:       3,
-			},
-			want: []string{
-				"lorem ipsum",
-				"dolor sit",
-				"amet consectetur",
-			},
-		},
-		{
-			name: "test uneven number of lines",
-			args: args{
-				content: "lorem ipsum\ndolor sit\namet consectetur\nadipiscing elit",
-				n:       3,
-			},
-			want: []string{
-				"lorem ipsum\ndolor sit",
-				"amet consectetur",
-				"adipiscing elit",
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := partitionContent(tt.args.content, tt.args.n); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("partitionContent() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func Test_mapContent(t *testing.T) {
-
-	server_address := mapServer.Listener.Addr().(*net.TCPAddr)
-	t.Setenv("MAP_SVC_NAME", server_address.IP.String())
-	t.Setenv("MAP_SVC_PORT", strconv.Itoa(server_address.Port))
-
-	type args struct {
-		content          string
-		http_workers_num int
-	}
-	tests := []struct {
-		name    string
-		args    args
-		want    []map[string]int
-		wantErr string
-	}{
-		{
-			name: "test map content",
-			args: args{
-				content:          "lorem lorem\nlorem ipsum\nipsum sit",
-				http_workers_num: 3,
-			},
-			want: []map[string]int{
-				{"lorem": 1},
-				{"lorem": 1},
-				{"lorem": 1},
-				{"ipsum": 1},
-				{"ipsum": 1},
-				{"sit": 1},
-			},
-		},
-		{
-			name: "test gibberish response",
-			args: args{
-				content:          "send me gibberish",
-				http_workers_num: 3,
-			},
-			wantErr: "invalid character 'b' looking for beginning of value",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := mapContent(tt.args.content, tt.args.http_workers_num)
-			if err != nil {
-				assert.EqualErrorf(t, err, tt.wantErr, "map_content() =  %q, want %q", err.Error(), tt.wantErr)
-			}
-
-			if !slicesDeepEqual(got, tt.want) {
-				t.Errorf("map_content() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func Test_getShuffler(t *testing.T) {
-	type args struct {
-		mapping   map[string]int
-		shufflers int
-	}
-	tests := []struct {
-		name string
-		args args
-		want int
-	}{
-		{
-			name: "test get shuffler",
-			args: args{
-				mapping: map[string]int{
-					"lorem": 1,
-				},
-				shufflers: 3,
-			},
-			want: 1,
-		},
-		{
-			name: "test get shuffler 2",
-			args: args{
-				mapping: map[string]int{
-					"dolor": 1,
-				},
-				shufflers: 6,
-			},
-			want: 5,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := getShuffler(tt.args.mapping, tt.args.shufflers); got != tt.want {
-				t.Errorf("getShuffler() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func Test_shuffle(t *testing.T) {
-
-	server_address := shuffleServer.Listener.Addr().(*net.TCPAddr)
-	t.Setenv("SHUFFLE_SVC_NAME", shuffleServerARecord)
-	t.Setenv("SHUFFLE_SVC_PORT", strconv.Itoa(server_address.Port))
-
-	type args struct {
-		mappings []map[string]int
-	}
-	tests := []struct {
-		name    string
-		args    args
-		want    map[string][]int
-		wantErr string
-	}{
-		{
-			name: "test shuffle",
-			args: args{
-				mappings: []map[string]int{
-					{"lorem": 1},
-					{"lorem": 1},
-					{"lorem": 1},
-					{"ipsum": 1},
-					{"ipsum": 1},
-					{"sit": 1},
-				},
-			},
-			want: map[string][]int{
-				"lorem": {1, 1, 1},
-				"ipsum": {1, 1},
-				"sit":   {1},
-			},
-		},
-		{
-			name: "test gibberish response",
-			args: args{
-				mappings: []map[string]int{
-					{"gibberish": 1},
-				},
-			},
-			wantErr: "invalid character 'b' looking for beginning of value",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := shuffle(tt.args.mappings)
-			if err != nil {
-				assert.EqualErrorf(t, err, tt.wantErr, "shuffle() =  %q, want %q", err.Error(), tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("shuffle() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func Test_partitionShuffle(t *testing.T) {
-	type args struct {
-		shuffle map[string][]int
-		n       int
-	}
-	tests := []struct {
-		name string
-		args args
-	}{
-		{
-			name: "test partition shuffle",
-			args: args{
-				shuffle: map[string][]int{
-					"lorem":       {1, 1, 1},
-					"ipsum":       {1, 1},
-					"dolor":       {1, 1},
-					"sit":         {1},
-					"amet":        {1},
-					"consectetur": {1, 1, 1},
-				},
-				n: 3,
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := partitionShuffle(tt.args.shuffle, tt.args.n); len(got) != tt.args.n {
-				t.Errorf("partitionShuffle() = unexpected result: %v", got)
-			}
-		})
-	}
-}
-
-func Test_reduce(t *testing.T) {
-
-	server_address := reduceServer.Listener.Addr().(*net.TCPAddr)
-	t.Setenv("REDUCE_SVC_NAME", server_address.IP.String())
-	t.Setenv("REDUCE_SVC_PORT", strconv.Itoa(server_address.Port))
-
-	type args struct {
-		shuffle          map[string][]int
-		http_workers_num int
-	}
-	tests := []struct {
-		name    string
-		args    args
-		want    map[string]int
-		wantErr string
-	}{
-		{
-			name: "test reduce",
-			args: args{
-				shuffle: map[string][]int{
-					"lorem": {1, 1, 1},
-					"ipsum": {1, 1},
-					"sit":   {1},
-				},
-				http_workers_num: 3,
-			},
-			want: map[string]int{
-				"lorem": 3,
-				"ipsum": 2,
-				"sit":   1,
-			},
-		},
-		{
-			name: "test gibberish response",
-			args: args{
-				shuffle: map[string][]int{
-					"gibberish": {1, 1, 1},
-				},
-				http_workers_num: 3,
-			},
-			wantErr: "invalid character 'b' looking for beginning of value",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := reduce(tt.args.shuffle, tt.args.http_workers_num)
-			if err != nil {
-				assert.EqualErrorf(t, err, tt.wantErr, "reduce() =  %q, want %q", err.Error(), tt.wantErr)
-			}
-
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("reduce() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func Test_coordinatorHandler(t *testing.T) {
 
 	mapServerAddress := mapServer.Listener.Addr().(*net.TCPAddr)
@@ -321,6 +40,9 @@ func Test_coordinatorHandler(t *testing.T) {
 	t.Setenv("REDUCE_SVC_NAME", redServerAddress.IP.String())
 	t.Setenv("REDUCE_SVC_PORT", strconv.Itoa(redServerAddress.Port))
 
+	// the mock map server knows the lines of the documents, up to 11 bytes
+	t.Setenv("MAP_TASK_BYTES", "11")
+
 	type args struct {
 		r *http.Request
 		w *httptest.ResponseRecorder
@@ -329,7 +51,11 @@ func Test_coordinatorHandler(t *testing.T) {
 		name            string
 		args            args
 		numWorkers      string
+		wireFormat      string
+		splitMode       string
+		jobTimeout      string
 		wantStatus      int
+		wantJobID       bool
 		wantHeader      http.Header
 		wantBodySuccess map[string]int
 		wantBodyFailure string
@@ -339,12 +65,60 @@ func Test_coordinatorHandler(t *testing.T) {
 			args: args{
 				w: httptest.NewRecorder(),
 				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
+				},
+			},
+			numWorkers: "3",
+			wantStatus: http.StatusOK,
+			wantJobID:  true,
+			wantHeader: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			wantBodySuccess: map[string]int{
+				"lorem": 3,
+				"ipsum": 2,
+				"sit":   1,
+			},
+		},
+		{
+			name: "test coordinator handler legacy wire format",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
 					Method: http.MethodPost,
 					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
 				},
 			},
 			numWorkers: "3",
+			wireFormat: "legacy",
 			wantStatus: http.StatusOK,
+			wantJobID:  true,
+			wantHeader: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			wantBodySuccess: map[string]int{
+				"lorem": 3,
+				"ipsum": 2,
+				"sit":   1,
+			},
+		},
+		{
+			name: "test coordinator handler split by lines",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
+				},
+			},
+			numWorkers: "3",
+			splitMode:  "lines",
+			wantStatus: http.StatusOK,
+			wantJobID:  true,
 			wantHeader: http.Header{
 				"Content-Type": []string{"application/json"},
 			},
@@ -359,6 +133,7 @@ func Test_coordinatorHandler(t *testing.T) {
 			args: args{
 				w: httptest.NewRecorder(),
 				r: &http.Request{
+					URL:    &url.URL{},
 					Method: http.MethodGet,
 					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
 				},
@@ -372,16 +147,18 @@ func Test_coordinatorHandler(t *testing.T) {
 			wantBodyFailure: "Method Not Allowed\n",
 		},
 		{
-			name: "test coordinator handler wrong number of workers",
+			name: "test coordinator handler map fail",
 			args: args{
 				w: httptest.NewRecorder(),
 				r: &http.Request{
+					URL:    &url.URL{},
 					Method: http.MethodPost,
-					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
+					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit pacet")),
 				},
 			},
-			numWorkers: "3a",
+			numWorkers: "3",
 			wantStatus: http.StatusInternalServerError,
+			wantJobID:  true,
 			wantHeader: http.Header{
 				"Content-Type":           []string{"text/plain; charset=utf-8"},
 				"X-Content-Type-Options": []string{"nosniff"},
@@ -389,33 +166,62 @@ func Test_coordinatorHandler(t *testing.T) {
 			wantBodyFailure: "Internal Server Error\n",
 		},
 		{
-			name: "test coordinator handler map fail",
+			name: "test coordinator handler timeout",
 			args: args{
 				w: httptest.NewRecorder(),
 				r: &http.Request{
+					URL:    &url.URL{},
 					Method: http.MethodPost,
-					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit pacet")),
+					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
 				},
 			},
 			numWorkers: "3",
-			wantStatus: http.StatusInternalServerError,
+			jobTimeout: "1ns",
+			wantStatus: http.StatusGatewayTimeout,
+			wantJobID:  true,
 			wantHeader: http.Header{
 				"Content-Type":           []string{"text/plain; charset=utf-8"},
 				"X-Content-Type-Options": []string{"nosniff"},
 			},
-			wantBodyFailure: "Internal Server Error\n",
+			wantBodyFailure: "Gateway Timeout\n",
+		},
+		{
+			name: "test coordinator handler unknown job",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "job=unknown"},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
+				},
+			},
+			numWorkers: "3",
+			wantStatus: http.StatusBadRequest,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Bad Request\n",
 		},
 	}
 	for _, tt := range tests {
 
 		t.Run(tt.name, func(t *testing.T) {
 			t.Setenv("HTTP_WORKERS_NUM", tt.numWorkers)
+			t.Setenv("WIRE_FORMAT", tt.wireFormat)
+			t.Setenv("SPLIT_MODE", tt.splitMode)
+			t.Setenv("JOB_TIMEOUT", tt.jobTimeout)
+			loadSettings(t)
 			coordinatorHandler(tt.args.w, tt.args.r)
 
 			assert.Equalf(t, tt.wantStatus, tt.args.w.Code, "coordinatorHandler() = %d, expected status code: %d", tt.args.w.Code, tt.wantStatus)
 
-			if !reflect.DeepEqual(tt.args.w.Header(), tt.wantHeader) {
-				t.Errorf("coordinatorHandler() = %v, want %v", tt.args.w.Header(), tt.wantHeader)
+			// the ID of a submitted job is random
+			header := tt.args.w.Header().Clone()
+			assert.Equal(t, tt.wantJobID, header.Get(logging.JobIDHeader) != "", "coordinatorHandler() job ID = %q", header.Get(logging.JobIDHeader))
+			header.Del(logging.JobIDHeader)
+			if !reflect.DeepEqual(header, tt.wantHeader) {
+				t.Errorf("coordinatorHandler() = %v, want %v", header, tt.wantHeader)
 			}
 
 			if tt.args.w.Code == http.StatusOK {
@@ -435,31 +241,6 @@ func Test_coordinatorHandler(t *testing.T) {
 	}
 }
 
-func slicesDeepEqual(a, b []map[string]int) bool {
-	if len(a) != len(b) {
-		return false
-	}
-
-	visited := make([]bool, len(b))
-	for _, mapA := range a {
-		found := false
-		for i := 0; i < len(b); i++ {
-			if visited[i] {
-				continue
-			}
-			if reflect.DeepEqual(mapA, b[i]) {
-				visited[i] = true
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
-	}
-	return true
-}
-
 func mapServerHandler(w http.ResponseWriter, r *http.Request) {
 
 	body, err := io.ReadAll(r.Body)
@@ -470,16 +251,31 @@ func mapServerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// successful mapping
-	switch string(body) {
-	case "lorem lorem":
-		w.Write([]byte(`[{"lorem":1},{"lorem":1}]`))
-		return
-	case "lorem ipsum":
-		w.Write([]byte(`[{"lorem":1},{"ipsum":1}]`))
-		return
-	case "ipsum sit":
-		w.Write([]byte(`[{"ipsum":1},{"sit":1}]`))
-		return
+	if kv.Negotiate(r.Header.Get("Accept")) == kv.ContentType {
+		w.Header().Set("Content-Type", kv.ContentType)
+		switch string(body) {
+		case "lorem lorem":
+			w.Write([]byte(`[["lorem",1],["lorem",1]]`))
+			return
+		case "lorem ipsum":
+			w.Write([]byte(`[["lorem",1],["ipsum",1]]`))
+			return
+		case "ipsum sit":
+			w.Write([]byte(`[["ipsum",1],["sit",1]]`))
+			return
+		}
+	} else {
+		switch string(body) {
+		case "lorem lorem":
+			w.Write([]byte(`[{"lorem":1},{"lorem":1}]`))
+			return
+		case "lorem ipsum":
+			w.Write([]byte(`[{"lorem":1},{"ipsum":1}]`))
+			return
+		case "ipsum sit":
+			w.Write([]byte(`[{"ipsum":1},{"sit":1}]`))
+			return
+		}
 	}
 
 	// otherwise send non-JSON gibberish
@@ -495,17 +291,45 @@ func shuffleServerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// successful shuffling
-	switch string(body) {
-	case "[{\"lorem\":1},{\"lorem\":1},{\"lorem\":1}]":
-		w.Write([]byte(`{"lorem":[1,1,1]}`))
-		return
-	case "[{\"ipsum\":1},{\"ipsum\":1}]":
-		w.Write([]byte(`{"ipsum":[1,1]}`))
-		return
-	case "[{\"sit\":1}]":
-		w.Write([]byte(`{"sit":[1]}`))
-		return
+	// successful shuffling and reduce
+	if r.URL.Path == mapreduce.ShuffleReducePath {
+		w.Header().Set("Content-Type", kv.ContentType)
+		switch string(body) {
+		case `[["lorem",1],["lorem",1],["lorem",1]]`:
+			w.Write([]byte(`[["lorem",3]]`))
+			return
+		case `[["ipsum",1],["ipsum",1]]`:
+			w.Write([]byte(`[["ipsum",2]]`))
+			return
+		case `[["sit",1]]`:
+			w.Write([]byte(`[["sit",1]]`))
+			return
+		}
+	} else if r.Header.Get("Content-Type") == kv.ContentType {
+		w.Header().Set("Content-Type", kv.ContentType)
+		switch string(body) {
+		case `[["lorem",1],["lorem",1],["lorem",1]]`:
+			w.Write([]byte(`[["lorem",[1,1,1]]]`))
+			return
+		case `[["ipsum",1],["ipsum",1]]`:
+			w.Write([]byte(`[["ipsum",[1,1]]]`))
+			return
+		case `[["sit",1]]`:
+			w.Write([]byte(`[["sit",[1]]]`))
+			return
+		}
+	} else {
+		switch string(body) {
+		case "[{\"lorem\":1},{\"lorem\":1},{\"lorem\":1}]":
+			w.Write([]byte(`{"lorem":[1,1,1]}`))
+			return
+		case "[{\"ipsum\":1},{\"ipsum\":1}]":
+			w.Write([]byte(`{"ipsum":[1,1]}`))
+			return
+		case "[{\"sit\":1}]":
+			w.Write([]byte(`{"sit":[1]}`))
+			return
+		}
 	}
 
 	// otherwise send non-JSON gibberish
@@ -522,22 +346,153 @@ func reduceServerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// successful reduce
-	switch string(body) {
-	case `{"lorem":[1,1,1]}`:
-		w.Write([]byte(`{"lorem":3}`))
-		return
-	case `{"sit":[1]}`:
-		w.Write([]byte(`{"sit":1}`))
-		return
-	case `{"ipsum":[1,1]}`:
-		w.Write([]byte(`{"ipsum":2}`))
-		return
+	if r.Header.Get("Content-Type") == kv.ContentType {
+		w.Header().Set("Content-Type", kv.ContentType)
+		switch string(body) {
+		case `[["lorem",[1,1,1]]]`:
+			w.Write([]byte(`[["lorem",3]]`))
+			return
+		case `[["sit",[1]]]`:
+			w.Write([]byte(`[["sit",1]]`))
+			return
+		case `[["ipsum",[1,1]]]`:
+			w.Write([]byte(`[["ipsum",2]]`))
+			return
+		}
+	} else {
+		switch string(body) {
+		case `{"lorem":[1,1,1]}`:
+			w.Write([]byte(`{"lorem":3}`))
+			return
+		case `{"sit":[1]}`:
+			w.Write([]byte(`{"sit":1}`))
+			return
+		case `{"ipsum":[1,1]}`:
+			w.Write([]byte(`{"ipsum":2}`))
+			return
+		}
 	}
 
 	// otherwise send non-JSON gibberish
 	w.Write([]byte(`blah blah`))
 }
 
+func Test_coordinatorHandlerTopK(t *testing.T) {
+
+	mapServerAddress := mapServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("MAP_SVC_NAME", mapServerAddress.IP.String())
+	t.Setenv("MAP_SVC_PORT", strconv.Itoa(mapServerAddress.Port))
+
+	server_address := shuffleServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("SHUFFLE_SVC_NAME", shuffleServerARecord)
+	t.Setenv("SHUFFLE_SVC_PORT", strconv.Itoa(server_address.Port))
+
+	redServerAddress := reduceServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("REDUCE_SVC_NAME", redServerAddress.IP.String())
+	t.Setenv("REDUCE_SVC_PORT", strconv.Itoa(redServerAddress.Port))
+
+	t.Setenv("HTTP_WORKERS_NUM", "3")
+	t.Setenv("MAP_TASK_BYTES", "11")
+	loadSettings(t)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "test top k",
+			query:      "?top=2",
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"key":"lorem","count":3},{"key":"ipsum","count":2}]`,
+		},
+		{
+			name:       "test top k with filters",
+			query:      "?top=5&min_count=2&match=^i",
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"key":"ipsum","count":2}]`,
+		},
+		{
+			name:       "test invalid top k",
+			query:      "?top=-1",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Bad Request\n",
+		},
+		{
+			name:       "test top k of job without counts",
+			query:      "?job=invertedindex&top=2",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Bad Request\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			coordinatorHandler(w, httptest.NewRequest(http.MethodPost, "/"+tt.query, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_coordinatorHandlerReduceInShuffle(t *testing.T) {
+
+	mapServerAddress := mapServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("MAP_SVC_NAME", mapServerAddress.IP.String())
+	t.Setenv("MAP_SVC_PORT", strconv.Itoa(mapServerAddress.Port))
+
+	server_address := shuffleServer.Listener.Addr().(*net.TCPAddr)
+	t.Setenv("SHUFFLE_SVC_NAME", shuffleServerARecord)
+	t.Setenv("SHUFFLE_SVC_PORT", strconv.Itoa(server_address.Port))
+
+	// the map server answers gibberish to reduce tasks, so the job fails if
+	// any reaches the reduce service
+	t.Setenv("REDUCE_SVC_NAME", mapServerAddress.IP.String())
+	t.Setenv("REDUCE_SVC_PORT", strconv.Itoa(mapServerAddress.Port))
+
+	t.Setenv("HTTP_WORKERS_NUM", "3")
+	t.Setenv("MAP_TASK_BYTES", "11")
+	t.Setenv("REDUCE_IN_SHUFFLE", "true")
+	loadSettings(t)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantBody string
+	}{
+		{
+			name:     "test reduce in shuffle",
+			wantBody: `{"ipsum":2,"lorem":3,"sit":1}`,
+		},
+		{
+			name:     "test reduce in shuffle top k",
+			query:    "?top=2",
+			wantBody: `[{"key":"lorem","count":3},{"key":"ipsum","count":2}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			coordinatorHandler(w, httptest.NewRequest(http.MethodPost, "/"+tt.query, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+// loadSettings loads the settings of the coordinator from the environment
+// of the test, and resets them when the test ends.
+func loadSettings(t *testing.T) {
+	t.Helper()
+	t.Cleanup(settings.Reset)
+	if err := settings.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestMain(m *testing.M) {
 
 	mapServer = httptest.NewServer(http.HandlerFunc(mapServerHandler))
@@ -562,6 +517,13 @@ func TestMain(m *testing.M) {
 	}, false)
 	defer srv.Close()
 
+	// retry failed tasks without waiting
+	os.Setenv("TASK_RETRY_BACKOFF", "0s")
+
+	// the shuffle workers share an IP, hence a name, so the keys are spread
+	// among them modulo their number, one key per task
+	os.Setenv("SHUFFLE_PARTITIONER", "modulo")
+
 	srv.PatchNet(net.DefaultResolver)
 	defer mockdns.UnpatchNet(net.DefaultResolver)
 
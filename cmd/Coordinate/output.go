@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FDeRubeis/mapreduce/internal/job"
+	"github.com/FDeRubeis/mapreduce/internal/output"
+	log "github.com/sirupsen/logrus"
+)
+
+// errBadView is the error of a request for a result view that cannot be
+// produced, such as an invalid cursor.
+var errBadView = errors.New("invalid result view")
+
+// wildcardFormats are the formats matched by each media range with a
+// wildcard, in order of preference.
+var wildcardFormats = map[string][]string{
+	"*/*":           {output.JSON, output.CSV, output.TSV, output.NDJSON},
+	"application/*": {output.JSON, output.NDJSON},
+	"text/*":        {output.CSV, output.TSV},
+}
+
+// negotiateOutput returns the output format to answer with, given the Accept
+// header of a request, or "" if none of the accepted formats is supported.
+// The format of the media range with the highest quality wins, the first one
+// on a tie, and a format with a quality of 0 is never chosen, even through a
+// wildcard. Clients that do not ask for a format get JSON.
+func negotiateOutput(accept string) string {
+
+	if strings.TrimSpace(accept) == "" {
+		return output.JSON
+	}
+
+	type mediaRange struct {
+		mediaType string
+		quality   float64
+	}
+	ranges := []mediaRange{}
+	refused := map[string]bool{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+		if quality == 0 {
+			refused[mediaType] = true
+			continue
+		}
+		ranges = append(ranges, mediaRange{mediaType, quality})
+	}
+	sort.SliceStable(ranges, func(a, b int) bool {
+		return ranges[a].quality > ranges[b].quality
+	})
+
+	for _, r := range ranges {
+		switch r.mediaType {
+		case output.JSON, output.CSV, output.TSV, output.NDJSON:
+			if !refused[r.mediaType] {
+				return r.mediaType
+			}
+		}
+		for _, format := range wildcardFormats[r.mediaType] {
+			if !refused[format] {
+				return format
+			}
+		}
+	}
+	return ""
+}
+
+// resultView is how a result is written: its format, its order and the page
+// of keys to write.
+type resultView struct {
+	format string
+	order  string
+	// limit is the number of keys of a page, or 0 for all the keys
+	limit int
+	// cursor is the last key of the previous page
+	cursor string
+	top    *job.TopK
+}
+
+// getResultView reads the view of the result asked by a request: the format
+// from the Accept header and the sort, limit and cursor parameters.
+func getResultView(r *http.Request, top *job.TopK) (resultView, error) {
+
+	view := resultView{format: negotiateOutput(r.Header.Get("Accept")), order: output.ByKey, top: top}
+	if view.format == "" {
+		return view, fmt.Errorf("%w: no acceptable format in %q", errBadView, r.Header.Get("Accept"))
+	}
+	if top != nil {
+		view.order = output.ByCount
+	}
+
+	// only the result of an asynchronous job can be fetched again, to get
+	// the next pages
+	params := r.URL.Query()
+	if r.Method != http.MethodGet && (params.Has("limit") || params.Has("cursor")) {
+		return view, fmt.Errorf("%w: limit and cursor are only for the result of an asynchronous job", errBadView)
+	}
+
+	switch v := params.Get("sort"); v {
+	case "":
+	case output.ByKey, output.ByCount:
+		view.order = v
+	default:
+		return view, fmt.Errorf("%w: sort %q", errBadView, v)
+	}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return view, fmt.Errorf("%w: limit %q", errBadView, v)
+		}
+		view.limit = n
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		cursor, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return view, fmt.Errorf("%w: cursor %q", errBadView, v)
+		}
+		view.cursor = string(cursor)
+	}
+
+	return view, nil
+}
+
+// page returns the rows of the page of the view, and whether more follow.
+// The rows are sorted in the order of the view, and result has the value of
+// the cursor.
+func (v resultView) page(rows []output.Row, result map[string]json.RawMessage) ([]output.Row, bool, error) {
+
+	if v.cursor != "" {
+		i, found := output.Search(rows, v.order, output.Row{Key: v.cursor, Value: result[v.cursor]})
+		if !found {
+			return nil, false, fmt.Errorf("%w: unknown cursor", errBadView)
+		}
+		rows = rows[i+1:]
+	}
+
+	if v.limit > 0 && len(rows) > v.limit {
+		return rows[:v.limit], true, nil
+	}
+	return rows, false, nil
+}
+
+// resultViewRequest reads the view of the result asked by a request. If the
+// view is invalid, it writes the error response and returns false.
+func resultViewRequest(w http.ResponseWriter, r *http.Request, top *job.TopK) (resultView, bool) {
+
+	view, err := getResultView(r, top)
+	if err != nil {
+		status := http.StatusBadRequest
+		if view.format == "" {
+			status = http.StatusNotAcceptable
+		}
+		http.Error(w, http.StatusText(status), status)
+		log.Errorf("Invalid result request: %s", err)
+		return view, false
+	}
+
+	return view, true
+}
+
+// writeResult writes the final values of a finished job in the view asked
+// by the request. By default, they are a JSON object. The result of a top-K
+// query is an array sorted by count.
+func writeResult(w http.ResponseWriter, r *http.Request, rec *jobRecord) {
+
+	view, ok := resultViewRequest(w, r, rec.top)
+	if !ok {
+		return
+	}
+
+	rows, err := rec.rows(view.order)
+	if err == nil {
+		rec.mu.Lock()
+		result := rec.result
+		rec.mu.Unlock()
+
+		var more bool
+		if rows, more, err = view.page(rows, result); err == nil && more {
+			w.Header().Set("Link", nextPageLink(r, rows[len(rows)-1].Key))
+		}
+	}
+	if errors.Is(err, errBadView) {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		log.Errorf("Invalid result request: %s", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		log.Errorf("Error ranking result: %s", err)
+		return
+	}
+
+	// stream the rows, the response has started once they are written
+	w.Header().Set("Content-Type", view.format)
+	if err := output.Encode(w, view.format, rows, view.top != nil); err != nil {
+		log.Errorf("Error writing answer: %s", err)
+		return
+	}
+}
+
+// nextPageLink returns the Link header to the page after the given key.
+func nextPageLink(r *http.Request, last string) string {
+	next := url.URL{Path: r.URL.Path}
+	params := r.URL.Query()
+	params.Set("cursor", base64.RawURLEncoding.EncodeToString([]byte(last)))
+	next.RawQuery = params.Encode()
+	return fmt.Sprintf(`<%s>; rel="next"`, next.String())
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/job"
+	"github.com/FDeRubeis/mapreduce/internal/output"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_negotiateOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{name: "test no accept", accept: "", want: output.JSON},
+		{name: "test any", accept: "*/*", want: output.JSON},
+		{name: "test csv", accept: "text/csv", want: output.CSV},
+		{name: "test tsv with parameters", accept: "text/tab-separated-values; charset=utf-8", want: output.TSV},
+		{name: "test ndjson among others", accept: "application/xml, application/x-ndjson;q=0.9", want: output.NDJSON},
+		{name: "test unsupported", accept: "application/xml", want: ""},
+		{name: "test quality", accept: "text/csv;q=0.5, application/x-ndjson", want: output.NDJSON},
+		{name: "test first on a tie", accept: "text/csv;q=0.5, application/x-ndjson;q=0.5", want: output.CSV},
+		{name: "test refused", accept: "text/csv;q=0, application/json", want: output.JSON},
+		{name: "test refused through wildcard", accept: "*/*, application/json;q=0", want: output.CSV},
+		{name: "test only refused", accept: "text/csv;q=0", want: ""},
+		{name: "test invalid quality", accept: "text/csv;q=high, text/tab-separated-values", want: output.TSV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, negotiateOutput(tt.accept))
+		})
+	}
+}
+
+func Test_writeResult(t *testing.T) {
+
+	result := map[string]json.RawMessage{
+		"lorem":     json.RawMessage("3"),
+		"ipsum":     json.RawMessage("2"),
+		"sit":       json.RawMessage("2"),
+		"dolor\tam": json.RawMessage("1"),
+	}
+	cursor := func(key string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(key))
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		accept     string
+		top        url.Values
+		wantStatus int
+		wantType   string
+		wantLink   string
+		wantBody   string
+	}{
+		{
+			name:       "test json by key",
+			wantStatus: http.StatusOK,
+			wantType:   output.JSON,
+			wantBody:   `{"dolor\tam":1,"ipsum":2,"lorem":3,"sit":2}`,
+		},
+		{
+			name:       "test json by count",
+			query:      "sort=count",
+			wantStatus: http.StatusOK,
+			wantType:   output.JSON,
+			wantBody:   `{"lorem":3,"ipsum":2,"sit":2,"dolor\tam":1}`,
+		},
+		{
+			name:       "test csv",
+			accept:     "text/csv",
+			query:      "sort=count",
+			wantStatus: http.StatusOK,
+			wantType:   output.CSV,
+			wantBody:   "key,value\nlorem,3\nipsum,2\nsit,2\ndolor\tam,1\n",
+		},
+		{
+			name:       "test tsv",
+			accept:     "text/tab-separated-values",
+			wantStatus: http.StatusOK,
+			wantType:   output.TSV,
+			wantBody:   "key\tvalue\ndolor\\tam\t1\nipsum\t2\nlorem\t3\nsit\t2\n",
+		},
+		{
+			name:       "test ndjson",
+			accept:     "application/x-ndjson",
+			wantStatus: http.StatusOK,
+			wantType:   output.NDJSON,
+			wantBody:   "{\"key\":\"dolor\\tam\",\"value\":1}\n{\"key\":\"ipsum\",\"value\":2}\n{\"key\":\"lorem\",\"value\":3}\n{\"key\":\"sit\",\"value\":2}\n",
+		},
+		{
+			name:       "test first page",
+			query:      "sort=count&limit=2",
+			wantStatus: http.StatusOK,
+			wantType:   output.JSON,
+			wantLink:   `</jobs/1/result?cursor=` + cursor("ipsum") + `&limit=2&sort=count>; rel="next"`,
+			wantBody:   `{"lorem":3,"ipsum":2}`,
+		},
+		{
+			name:       "test last page",
+			query:      "sort=count&limit=2&cursor=" + cursor("ipsum"),
+			wantStatus: http.StatusOK,
+			wantType:   output.JSON,
+			wantBody:   `{"sit":2,"dolor\tam":1}`,
+		},
+		{
+			name:       "test cursor by key",
+			query:      "limit=1&cursor=" + cursor("ipsum"),
+			wantStatus: http.StatusOK,
+			wantType:   output.JSON,
+			wantLink:   `</jobs/1/result?cursor=` + cursor("lorem") + `&limit=1>; rel="next"`,
+			wantBody:   `{"lorem":3}`,
+		},
+		{
+			name:       "test no pages for synchronous jobs",
+			method:     http.MethodPost,
+			query:      "limit=2",
+			wantStatus: http.StatusBadRequest,
+			wantType:   "text/plain; charset=utf-8",
+			wantBody:   "Bad Request\n",
+		},
+		{
+			name:       "test top k",
+			top:        url.Values{"top": {"2"}},
+			wantStatus: http.StatusOK,
+			wantType:   output.JSON,
+			wantBody:   `[{"key":"lorem","count":3},{"key":"ipsum","count":2}]`,
+		},
+		{
+			name:       "test top k as csv",
+			accept:     "text/csv",
+			top:        url.Values{"top": {"2"}},
+			wantStatus: http.StatusOK,
+			wantType:   output.CSV,
+			wantBody:   "key,value\nlorem,3\nipsum,2\n",
+		},
+		{
+			name:       "test unknown cursor",
+			query:      "cursor=" + cursor("amet"),
+			wantStatus: http.StatusBadRequest,
+			wantType:   "text/plain; charset=utf-8",
+			wantBody:   "Bad Request\n",
+		},
+		{
+			name:       "test invalid sort",
+			query:      "sort=value",
+			wantStatus: http.StatusBadRequest,
+			wantType:   "text/plain; charset=utf-8",
+			wantBody:   "Bad Request\n",
+		},
+		{
+			name:       "test not acceptable",
+			accept:     "application/xml",
+			wantStatus: http.StatusNotAcceptable,
+			wantType:   "text/plain; charset=utf-8",
+			wantBody:   "Not Acceptable\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			top, err := job.ParseTopK(tt.top)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/jobs/1/result?"+tt.query, nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+
+			writeResult(w, r, &jobRecord{result: result, top: top})
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantLink, w.Header().Get("Link"))
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_jobRecordRows(t *testing.T) {
+
+	rec := &jobRecord{result: map[string]json.RawMessage{
+		"lorem": json.RawMessage("3"),
+		"ipsum": json.RawMessage("2"),
+	}}
+
+	// the rows are sorted once per order
+	byKey, err := rec.rows(output.ByKey)
+	assert.NoError(t, err)
+	again, err := rec.rows(output.ByKey)
+	assert.NoError(t, err)
+	assert.Same(t, &byKey[0], &again[0])
+
+	byCount, err := rec.rows(output.ByCount)
+	assert.NoError(t, err)
+	assert.Equal(t, "lorem", byCount[0].Key)
+	assert.Equal(t, "ipsum", byKey[0].Key)
+
+	rec = &jobRecord{result: map[string]json.RawMessage{"lorem": json.RawMessage(`["doc1"]`)}}
+	_, err = rec.rows(output.ByCount)
+	assert.ErrorIs(t, err, errBadView)
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+)
+
+// registerRetryPolicy registers the retry policy of the tasks, stored in p,
+// as task-max-attempts and task-retry-backoff.
+func registerRetryPolicy(s *config.Set, p *mapreduce.RetryPolicy) {
+	s.IntVar(&p.MaxAttempts, "task-max-attempts", mapreduce.DefaultRetryPolicy.MaxAttempts, 1, "attempts of a task")
+	s.DurationVar(&p.Backoff, "task-retry-backoff", mapreduce.DefaultRetryPolicy.Backoff, "wait before the first retry of a task, doubled on each retry")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_registerRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts string
+		backoff     string
+		want        mapreduce.RetryPolicy
+		wantErr     string
+	}{
+		{
+			name: "test defaults",
+			want: mapreduce.DefaultRetryPolicy,
+		},
+		{
+			name:        "test configured policy",
+			maxAttempts: "5",
+			backoff:     "1s",
+			want:        mapreduce.RetryPolicy{MaxAttempts: 5, Backoff: time.Second},
+		},
+		{
+			name:        "test invalid max attempts",
+			maxAttempts: "0",
+			wantErr:     "invalid TASK_MAX_ATTEMPTS: 0: must be at least 1",
+		},
+		{
+			name:    "test invalid backoff",
+			backoff: "-1s",
+			wantErr: "invalid TASK_RETRY_BACKOFF: -1s: must not be negative",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TASK_MAX_ATTEMPTS", tt.maxAttempts)
+			t.Setenv("TASK_RETRY_BACKOFF", tt.backoff)
+
+			var got mapreduce.RetryPolicy
+			s := config.New("test")
+			registerRetryPolicy(s, &got)
+			err := s.Load(nil)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+	log "github.com/sirupsen/logrus"
+)
+
+// partitioners of the mappings among the shuffle workers
+const (
+	rendezvousPartitioner = "rendezvous"
+	moduloPartitioner     = "modulo"
+)
+
+// shuffleWorker is a shuffle worker found behind the shuffle service.
+type shuffleWorker struct {
+	// name identifies the worker across lookups: the name of its pod, such
+	// as "shuffle-3", or its IP if it has none.
+	name string
+	ip   net.IP
+}
+
+// shuffleWorkers are the shuffle workers of a job, sorted by name. Shuffle
+// task i goes to worker i.
+type shuffleWorkers []shuffleWorker
+
+// resolver looks up the shuffle workers. It is implemented by net.Resolver.
+type resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// reverseLookupAttempts is the number of reverse lookups of a shuffle
+// worker that fail before the lookup of the workers fails.
+const reverseLookupAttempts = 3
+
+// reverseLookupBackoff is the wait before a failed reverse lookup is retried.
+var reverseLookupBackoff = 50 * time.Millisecond
+
+// lookupShuffleWorkers finds the workers behind the headless service and
+// names them by the reverse lookup of their IP. The pods of a StatefulSet
+// resolve to their name in the service, such as
+// "shuffle-3.shuffle.default.svc.cluster.local.", which does not change when
+// the pod is rescheduled, while its IP and the order of the lookups do.
+func lookupShuffleWorkers(ctx context.Context, r resolver, service string) (shuffleWorkers, error) {
+
+	ips, err := r.LookupIP(ctx, "ip", service)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := make(shuffleWorkers, 0, len(ips))
+	for _, ip := range ips {
+		name, err := lookupWorkerName(ctx, r, ip)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, shuffleWorker{name: name, ip: ip})
+	}
+
+	sort.SliceStable(workers, func(i, j int) bool {
+		return workers[i].name < workers[j].name
+	})
+	return workers, nil
+}
+
+// lookupWorkerName returns the name of the pod of a shuffle worker, by the
+// reverse lookup of its IP, which is retried after reverseLookupBackoff when
+// it fails. A worker without a PTR record is named by its IP, so that the keys
+// of its shuffle task move when its pod is rescheduled.
+func lookupWorkerName(ctx context.Context, r resolver, ip net.IP) (string, error) {
+
+	addr := ip.String()
+	var err error
+	for n := range reverseLookupAttempts {
+
+		// the last failure is returned if the context is done while waiting
+		if n > 0 {
+			select {
+			case <-time.After(reverseLookupBackoff):
+			case <-ctx.Done():
+				return "", fmt.Errorf("looking up the name of the shuffle worker %s: %w: %w", addr, err, context.Cause(ctx))
+			}
+		}
+
+		var names []string
+		names, err = r.LookupAddr(ctx, addr)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		var dnsErr *net.DNSError
+		if len(names) > 0 {
+			name, _, _ := strings.Cut(names[0], ".")
+			return name, nil
+		}
+		if err == nil || errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			log.Warnf("Naming the shuffle worker %s by its IP, which changes when its pod is rescheduled: it has no PTR record", addr)
+			return addr, nil
+		}
+	}
+
+	return "", fmt.Errorf("looking up the name of the shuffle worker %s: %w", addr, err)
+}
+
+// names returns the names of the workers.
+func (w shuffleWorkers) names() []string {
+	names := make([]string, len(w))
+	for i, worker := range w {
+		names[i] = worker.name
+	}
+	return names
+}
+
+// ips returns the IPs of the workers.
+func (w shuffleWorkers) ips() []net.IP {
+	ips := make([]net.IP, len(w))
+	for i, worker := range w {
+		ips[i] = worker.ip
+	}
+	return ips
+}
+
+// partitioner returns the partitioner of the kind over the workers:
+// rendezvous hashing of their names, or the hash of the keys modulo their
+// number.
+func (w shuffleWorkers) partitioner(kind string) mapreduce.Partitioner {
+	if kind == moduloPartitioner {
+		return mapreduce.HashPartitioner
+	}
+	return mapreduce.RendezvousPartitioner(w.names())
+}
+
+// registerSkewPolicy registers the spreading of the hot keys, stored in p, as
+// hot-key-share, hot-key-sample-rate and hot-key-splits.
+func registerSkewPolicy(s *config.Set, p *mapreduce.SkewPolicy) {
+	s.FloatVar(&p.HotShare, "hot-key-share", 0, 0, 1, "share of the mappings above which a key is spread among several shuffle workers, 0 to spread none")
+	s.IntVar(&p.SampleRate, "hot-key-sample-rate", mapreduce.DefaultSampleRate, 1, "mappings per sampled mapping, to find the hot keys")
+	s.IntVar(&p.Splits, "hot-key-splits", 0, 0, "shuffle workers a hot key is spread among, 0 for all")
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+	"github.com/foxcpp/go-mockdns"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_lookupShuffleWorkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		zones   map[string]mockdns.Zone
+		want    shuffleWorkers
+		wantErr bool
+	}{
+		{
+			name: "test named by pod",
+			zones: map[string]mockdns.Zone{
+				"shuffle.":               {A: []string{"10.0.0.9", "10.0.0.7", "10.0.0.8"}},
+				"9.0.0.10.in-addr.arpa.": {PTR: []string{"shuffle-0.shuffle.default.svc.cluster.local."}},
+				"7.0.0.10.in-addr.arpa.": {PTR: []string{"shuffle-2.shuffle.default.svc.cluster.local."}},
+				"8.0.0.10.in-addr.arpa.": {PTR: []string{"shuffle-1.shuffle.default.svc.cluster.local."}},
+			},
+			want: shuffleWorkers{
+				{name: "shuffle-0", ip: net.ParseIP("10.0.0.9")},
+				{name: "shuffle-1", ip: net.ParseIP("10.0.0.8")},
+				{name: "shuffle-2", ip: net.ParseIP("10.0.0.7")},
+			},
+		},
+		{
+			name: "test named by IP",
+			zones: map[string]mockdns.Zone{
+				"shuffle.":               {A: []string{"10.0.0.9", "10.0.0.7"}},
+				"9.0.0.10.in-addr.arpa.": {PTR: []string{"shuffle-0.shuffle.default.svc.cluster.local."}},
+			},
+			want: shuffleWorkers{
+				{name: "10.0.0.7", ip: net.ParseIP("10.0.0.7")},
+				{name: "shuffle-0", ip: net.ParseIP("10.0.0.9")},
+			},
+		},
+		{
+			name: "test reverse lookup failure",
+			zones: map[string]mockdns.Zone{
+				"shuffle.":               {A: []string{"10.0.0.9", "10.0.0.7"}},
+				"9.0.0.10.in-addr.arpa.": {PTR: []string{"shuffle-0.shuffle.default.svc.cluster.local."}},
+				"7.0.0.10.in-addr.arpa.": {Err: errors.New("timeout")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "test unknown service",
+			zones: map[string]mockdns.Zone{
+				"map.": {A: []string{"10.0.0.9"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lookupShuffleWorkers(context.Background(), &mockdns.Resolver{Zones: tt.zones}, "shuffle.")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, len(tt.want), len(got))
+			for i := range tt.want {
+				assert.Equal(t, tt.want[i].name, got[i].name)
+				assert.True(t, tt.want[i].ip.Equal(got[i].ip), "%s != %s", tt.want[i].ip, got[i].ip)
+			}
+		})
+	}
+}
+
+// flakyResolver fails the first reverse lookups.
+type flakyResolver struct {
+	*mockdns.Resolver
+	failures int
+}
+
+func (r *flakyResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if r.failures > 0 {
+		r.failures--
+		return nil, &net.DNSError{Err: "timeout", Name: addr, IsTimeout: true}
+	}
+	return r.Resolver.LookupAddr(ctx, addr)
+}
+
+func Test_lookupShuffleWorkersRetried(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	r := &flakyResolver{Resolver: &mockdns.Resolver{Zones: map[string]mockdns.Zone{
+		"shuffle.":               {A: []string{"10.0.0.9", "10.0.0.7"}},
+		"9.0.0.10.in-addr.arpa.": {PTR: []string{"shuffle-0.shuffle.default.svc.cluster.local."}},
+	}}}
+
+	// the failed reverse lookups are retried
+	r.failures = reverseLookupAttempts - 1
+	got, err := lookupShuffleWorkers(context.Background(), r, "shuffle.")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"10.0.0.7", "shuffle-0"}, got.names())
+	}
+
+	// the worker without a PTR record is named by its IP, with a warning
+	warnings := []string{}
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == log.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	assert.Equal(t, []string{"Naming the shuffle worker 10.0.0.7 by its IP, which changes when its pod is rescheduled: it has no PTR record"}, warnings)
+
+	// until they fail too often
+	r.failures = reverseLookupAttempts
+	_, err = lookupShuffleWorkers(context.Background(), r, "shuffle.")
+	assert.ErrorContains(t, err, "looking up the name of the shuffle worker 10.0.0.9")
+}
+
+func Test_lookupShuffleWorkersExpired(t *testing.T) {
+	defer func(backoff time.Duration) { reverseLookupBackoff = backoff }(reverseLookupBackoff)
+	reverseLookupBackoff = time.Minute
+
+	r := &flakyResolver{Resolver: &mockdns.Resolver{Zones: map[string]mockdns.Zone{
+		"shuffle.": {A: []string{"10.0.0.9"}},
+	}}, failures: reverseLookupAttempts}
+
+	// the backoff ends with the context, with the failure of the last lookup
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := lookupShuffleWorkers(ctx, r, "shuffle.")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var dnsErr *net.DNSError
+	if assert.ErrorAs(t, err, &dnsErr) {
+		assert.True(t, dnsErr.IsTimeout)
+	}
+	assert.Equal(t, reverseLookupAttempts-1, r.failures)
+}
+
+func Test_lookupShuffleWorkersCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := &mockdns.Resolver{Zones: map[string]mockdns.Zone{
+		"shuffle.":               {A: []string{"10.0.0.9"}},
+		"9.0.0.10.in-addr.arpa.": {Err: errors.New("timeout")},
+	}}
+	_, err := lookupShuffleWorkers(ctx, r, "shuffle.")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func Test_shuffleWorkers_partitioner(t *testing.T) {
+	workers := shuffleWorkers{{name: "shuffle-0"}, {name: "shuffle-1"}, {name: "shuffle-2"}}
+
+	// the modulo partitioner ignores the names
+	assert.Equal(t, mapreduce.HashPartitioner.Partition("lorem", 3), workers.partitioner(moduloPartitioner).Partition("lorem", 3))
+
+	// a key keeps its worker when a worker is added, unless it moves to it
+	before := workers.partitioner(rendezvousPartitioner)
+	scaled := append(workers[:3:3], shuffleWorker{name: "shuffle-3"})
+	after := scaled.partitioner(rendezvousPartitioner)
+	for _, key := range []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit"} {
+		if i := after.Partition(key, 4); i != 3 {
+			assert.Equal(t, before.Partition(key, 3), i, key)
+		}
+	}
+}
+
+func Test_registerSkewPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    mapreduce.SkewPolicy
+		wantErr string
+	}{
+		{
+			name: "test defaults",
+			want: mapreduce.SkewPolicy{SampleRate: mapreduce.DefaultSampleRate},
+		},
+		{
+			name: "test configured policy",
+			env:  map[string]string{"HOT_KEY_SHARE": "0.1", "HOT_KEY_SAMPLE_RATE": "10", "HOT_KEY_SPLITS": "3"},
+			want: mapreduce.SkewPolicy{HotShare: 0.1, SampleRate: 10, Splits: 3},
+		},
+		{
+			name:    "test invalid policy",
+			env:     map[string]string{"HOT_KEY_SHARE": "10%", "HOT_KEY_SAMPLE_RATE": "0", "HOT_KEY_SPLITS": "-1"},
+			wantErr: "invalid HOT_KEY_SHARE: 10%: not a number\ninvalid HOT_KEY_SAMPLE_RATE: 0: must be at least 1\ninvalid HOT_KEY_SPLITS: -1: must be at least 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"HOT_KEY_SHARE", "HOT_KEY_SAMPLE_RATE", "HOT_KEY_SPLITS"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			var got mapreduce.SkewPolicy
+			s := config.New("test")
+			registerSkewPolicy(s, &got)
+			err := s.Load(nil)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
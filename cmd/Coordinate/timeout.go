@@ -0,0 +1,34 @@
+package main
+
+import (
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+)
+
+// timeouts are the deadlines of the jobs, for the whole job and for each
+// phase. A zero timeout is no limit.
+type timeouts struct {
+	job     time.Duration
+	map_    time.Duration
+	shuffle time.Duration
+	reduce  time.Duration
+}
+
+// register registers the timeouts as job-timeout, map-timeout,
+// shuffle-timeout and reduce-timeout.
+func (t *timeouts) register(s *config.Set) {
+	s.DurationVar(&t.job, "job-timeout", 0, "deadline of a job, 0 for no limit")
+	s.DurationVar(&t.map_, "map-timeout", 0, "deadline of the map phase, 0 for no limit")
+	s.DurationVar(&t.shuffle, "shuffle-timeout", 0, "deadline of the shuffle phase, 0 for no limit")
+	s.DurationVar(&t.reduce, "reduce-timeout", 0, "deadline of the reduce phase, 0 for no limit")
+}
+
+// apply sets the timeouts of the engine.
+func (t timeouts) apply(engine *mapreduce.Engine) {
+	engine.Timeout = t.job
+	engine.MapTimeout = t.map_
+	engine.ShuffleTimeout = t.shuffle
+	engine.ReduceTimeout = t.reduce
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_timeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    mapreduce.Engine
+		wantErr string
+	}{
+		{
+			name: "test no timeouts",
+			want: mapreduce.Engine{},
+		},
+		{
+			name: "test configured timeouts",
+			env: map[string]string{
+				"JOB_TIMEOUT":     "10m",
+				"MAP_TIMEOUT":     "5m",
+				"SHUFFLE_TIMEOUT": "1m",
+				"REDUCE_TIMEOUT":  "2m",
+			},
+			want: mapreduce.Engine{
+				Timeout:        10 * time.Minute,
+				MapTimeout:     5 * time.Minute,
+				ShuffleTimeout: time.Minute,
+				ReduceTimeout:  2 * time.Minute,
+			},
+		},
+		{
+			name:    "test invalid timeout",
+			env:     map[string]string{"SHUFFLE_TIMEOUT": "soon"},
+			wantErr: "invalid SHUFFLE_TIMEOUT: soon: not a duration",
+		},
+		{
+			name:    "test negative timeout",
+			env:     map[string]string{"JOB_TIMEOUT": "-1s"},
+			wantErr: "invalid JOB_TIMEOUT: -1s: must not be negative",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"JOB_TIMEOUT", "MAP_TIMEOUT", "SHUFFLE_TIMEOUT", "REDUCE_TIMEOUT"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			var timeouts timeouts
+			s := config.New("test")
+			timeouts.register(s)
+			err := s.Load(nil)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			got := mapreduce.Engine{}
+			timeouts.apply(&got)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
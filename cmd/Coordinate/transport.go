@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+	"google.golang.org/grpc"
+)
+
+// rpcDialOptions are the options of the connections of the gRPC transport.
+var rpcDialOptions []grpc.DialOption
+
+// transports to the workers
+const (
+	httpTransport = "http"
+	grpcTransport = "grpc"
+)
+
+// record formats of the HTTP transport
+const (
+	kvFormat     = "kv"
+	legacyFormat = "legacy"
+)
+
+// workerService is a service of workers and its ports.
+type workerService struct {
+	name     string
+	port     int
+	grpcPort int
+}
+
+// register registers the service of the phase as <phase>-svc-name,
+// <phase>-svc-port and <phase>-svc-grpc-port. The ports default to the
+// listen ports of the workers.
+func (w *workerService) register(s *config.Set, phase string) {
+	s.StringVar(&w.name, phase+"-svc-name", phase, "DNS name of the "+phase+" service")
+	s.PortVar(&w.port, phase+"-svc-port", 80, "HTTP port of the "+phase+" service")
+	s.PortVar(&w.grpcPort, phase+"-svc-grpc-port", 9090, "gRPC port of the "+phase+" service")
+}
+
+// addr returns the address of the service for the transport.
+func (w workerService) addr(transport string) string {
+	port := w.port
+	if transport == grpcTransport {
+		port = w.grpcPort
+	}
+	return net.JoinHostPort(w.name, strconv.Itoa(port))
+}
+
+// transportConfig configures how the coordinator talks to the workers.
+type transportConfig struct {
+	// kind is httpTransport or grpcTransport.
+	kind string
+	// wireFormat is the record format of the HTTP transport: kvFormat, or
+	// legacyFormat for workers of the previous release.
+	wireFormat string
+
+	mapSvc     workerService
+	shuffleSvc workerService
+	reduceSvc  workerService
+}
+
+// register registers the transport as transport and wire-format, and the
+// worker services.
+func (c *transportConfig) register(s *config.Set) {
+	s.EnumVar(&c.kind, "transport", httpTransport, []string{httpTransport, grpcTransport}, "transport to the workers")
+	s.EnumVar(&c.wireFormat, "wire-format", kvFormat, []string{kvFormat, legacyFormat}, "record format of the HTTP transport")
+	c.mapSvc.register(s, "map")
+	c.shuffleSvc.register(s, "shuffle")
+	c.reduceSvc.register(s, "reduce")
+}
+
+// transport returns the transport to the workers. The shuffle tasks are sent
+// to the shuffle workers at ips.
+func (c transportConfig) transport(ips []net.IP) mapreduce.Transport {
+	if c.kind == grpcTransport {
+		return mapreduce.GRPCTransport{
+			MapAddr:      c.mapSvc.addr(grpcTransport),
+			ShuffleAddrs: workerAddrs(ips, c.shuffleSvc.grpcPort),
+			ReduceAddr:   c.reduceSvc.addr(grpcTransport),
+			DialOptions:  rpcDialOptions,
+		}
+	}
+
+	format := mapreduce.ContentType
+	if c.wireFormat == legacyFormat {
+		format = mapreduce.LegacyContentType
+	}
+	return mapreduce.HTTPTransport{
+		Format:       format,
+		MapAddr:      c.mapSvc.addr(httpTransport),
+		ShuffleAddrs: workerAddrs(ips, c.shuffleSvc.port),
+		ReduceAddr:   c.reduceSvc.addr(httpTransport),
+	}
+}
+
+// workerAddrs returns the addresses of the workers at ips.
+func workerAddrs(ips []net.IP, port int) []string {
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	}
+	return addrs
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/rpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func Test_grpcTransport(t *testing.T) {
+
+	// serve the workers on an in-process connection
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	rpc.RegisterMapper(s)
+	rpc.RegisterShuffler(s)
+	rpc.RegisterReducer(s)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	rpcDialOptions = []grpc.DialOption{grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})}
+	defer func() { rpcDialOptions = nil }()
+
+	t.Setenv("TRANSPORT", "grpc")
+	t.Setenv("HTTP_WORKERS_NUM", "3")
+	t.Setenv("MAP_SVC_NAME", "127.0.0.1")
+	t.Setenv("MAP_SVC_GRPC_PORT", "9090")
+	t.Setenv("SHUFFLE_SVC_NAME", shuffleServerARecord)
+	t.Setenv("SHUFFLE_SVC_GRPC_PORT", "9090")
+	t.Setenv("REDUCE_SVC_NAME", "127.0.0.1")
+	t.Setenv("REDUCE_SVC_GRPC_PORT", "9090")
+	loadSettings(t)
+
+	tests := []struct {
+		name       string
+		query      string
+		content    string
+		wantStatus int
+		wantBody   map[string]int
+	}{
+		{
+			name:       "test word count",
+			query:      "",
+			content:    "lorem lorem\nLorem ipsum\nipsum sit",
+			wantStatus: http.StatusOK,
+			wantBody: map[string]int{
+				"lorem": 3,
+				"ipsum": 2,
+				"sit":   1,
+			},
+		},
+		{
+			name:       "test word count with combiner",
+			query:      "?combine=true",
+			content:    "lorem lorem\nLorem ipsum\nipsum sit",
+			wantStatus: http.StatusOK,
+			wantBody: map[string]int{
+				"lorem": 3,
+				"ipsum": 2,
+				"sit":   1,
+			},
+		},
+		{
+			name:       "test rejected task",
+			query:      "?job=grep&pattern=(",
+			content:    "lorem lorem\nLorem ipsum\nipsum sit",
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			coordinatorHandler(w, httptest.NewRequest(http.MethodPost, "/"+tt.query, strings.NewReader(tt.content)))
+
+			assert.Equalf(t, tt.wantStatus, w.Code, "coordinatorHandler() = %d, expected status code: %d", w.Code, tt.wantStatus)
+			if w.Code != http.StatusOK {
+				return
+			}
+			response := map[string]int{}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if !reflect.DeepEqual(response, tt.wantBody) {
+				t.Errorf("coordinatorHandler() = %v, want %v", response, tt.wantBody)
+			}
+		})
+	}
+}
@@ -1,64 +1,65 @@
 package main
 
 import (
-	"encoding/json"
-	"io"
+	"context"
 	"net/http"
-	"regexp"
-	"strings"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/internal/metrics"
+	"github.com/FDeRubeis/mapreduce/internal/rpc"
+	"github.com/FDeRubeis/mapreduce/internal/server"
+	"github.com/FDeRubeis/mapreduce/internal/tracing"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
-func mapHandler(w http.ResponseWriter, r *http.Request) {
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// serve tasks over HTTP and gRPC, both counting towards the load
+	mux := http.NewServeMux()
+	service := &server.Service{HTTP: &http.Server{Handler: mux}}
+	tasks := tracing.Handler("map task", http.HandlerFunc(mapreduce.MapHandler))
+	mux.Handle("/", service.Track(logging.Handler("map", metrics.Instrument("map", tasks))))
+	service.GRPC = grpc.NewServer(
+		grpc.ChainStreamInterceptor(service.StreamInterceptor, tracing.StreamInterceptor, logging.StreamInterceptor("map")),
+		grpc.StatsHandler(metrics.GRPCStats{Service: "map"}),
+	)
+	rpc.RegisterMapper(service.GRPC)
+	rpc.RegisterHealth(service.GRPC)
 
-	if r.Method != http.MethodPost {
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-		log.Errorf("Request with method not allowed: %s", r.Method)
-		return
+	settings := config.New("map")
+	var logs logging.Config
+	var traces tracing.Config
+	logs.Register(settings)
+	traces.Register(settings)
+	service.Register(settings)
+	if err := settings.Load(os.Args[1:]); err != nil {
+		log.Fatal(err)
 	}
-	body, err := io.ReadAll(r.Body)
+
+	logging.Setup(logs)
+	flushSpans, err := tracing.Setup(ctx, "map", traces)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		log.Errorf("Error reading request body: %s", err)
-		return
+		log.Fatal(err)
 	}
 
-	// preprocess content
-	re := regexp.MustCompile(`[[:punct:]]`)
-	content := re.ReplaceAllString(string(body), "")
-	content = strings.ToLower(content)
+	mux.HandleFunc("GET /healthz", service.HealthHandler)
+	mux.HandleFunc("GET /readyz", service.ReadyHandler)
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /debug/config", settings)
 
-	// compute word mappings
-	words := strings.Fields(content)
-	mappings := []map[string]int{}
-	for _, word := range words {
-		mapping := map[string]int{
-			word: 1,
-		}
-
-		mappings = append(mappings, mapping)
+	err = service.Run(ctx)
+	if err := flushSpans(context.Background()); err != nil {
+		log.Errorf("Error flushing the spans: %s", err)
 	}
-
-	// write response
-	w.Header().Set("Content-Type", "application/json")
-	wm_marshaled, err := json.Marshal(mappings)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		log.Errorf("Error encoding mapping: %s", err)
-		return
-	}
-	if _, err := w.Write(wm_marshaled); err != nil {
-		log.Errorf("Error writing response: %s", err)
-		return
+		log.Fatal(err)
 	}
-
-	log.Infof("Successfully mapped the words in: %.8s...", content)
-
-}
-
-func main() {
-	http.HandleFunc("/", mapHandler)
-
-	http.ListenAndServe(":80", nil)
 }
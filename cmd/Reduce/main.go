@@ -1,61 +1,65 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/internal/metrics"
+	"github.com/FDeRubeis/mapreduce/internal/rpc"
+	"github.com/FDeRubeis/mapreduce/internal/server"
+	"github.com/FDeRubeis/mapreduce/internal/tracing"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
-func reduceHandler(w http.ResponseWriter, r *http.Request) {
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// serve tasks over HTTP and gRPC, both counting towards the load
+	mux := http.NewServeMux()
+	service := &server.Service{HTTP: &http.Server{Handler: mux}}
+	tasks := tracing.Handler("reduce task", http.HandlerFunc(mapreduce.ReduceHandler))
+	mux.Handle("/", service.Track(logging.Handler("reduce", metrics.Instrument("reduce", tasks))))
+	service.GRPC = grpc.NewServer(
+		grpc.ChainStreamInterceptor(service.StreamInterceptor, tracing.StreamInterceptor, logging.StreamInterceptor("reduce")),
+		grpc.StatsHandler(metrics.GRPCStats{Service: "reduce"}),
+	)
+	rpc.RegisterReducer(service.GRPC)
+	rpc.RegisterHealth(service.GRPC)
 
-	if r.Method != http.MethodPost {
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-		log.Errorf("Request with method not allowed: %s", r.Method)
-		return
+	settings := config.New("reduce")
+	var logs logging.Config
+	var traces tracing.Config
+	logs.Register(settings)
+	traces.Register(settings)
+	service.Register(settings)
+	if err := settings.Load(os.Args[1:]); err != nil {
+		log.Fatal(err)
 	}
-	body, err := io.ReadAll(r.Body)
+
+	logging.Setup(logs)
+	flushSpans, err := tracing.Setup(ctx, "reduce", traces)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		log.Errorf("Error reading request body: %s", err)
-		return
+		log.Fatal(err)
 	}
 
-	shuffle := map[string][]int{}
-	if err = json.Unmarshal(body, &shuffle); err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		log.Errorf("Error decoding JSON: %s", err)
-		return
-	}
+	mux.HandleFunc("GET /healthz", service.HealthHandler)
+	mux.HandleFunc("GET /readyz", service.ReadyHandler)
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /debug/config", settings)
 
-	// compute word count
-	wc := map[string]int{}
-	for word, mappings := range shuffle {
-		wc[word] = 0
-		for _, mapping := range mappings {
-			wc[word] += mapping
-		}
+	err = service.Run(ctx)
+	if err := flushSpans(context.Background()); err != nil {
+		log.Errorf("Error flushing the spans: %s", err)
 	}
-
-	// write response
-	w.Header().Set("Content-Type", "application/json")
-	wc_marshaled, err := json.Marshal(wc)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		log.Errorf("Error encoding word count: %s", err)
-		return
-	}
-	if _, err = w.Write(wc_marshaled); err != nil {
-		log.Errorf("Error writing response: %s", err)
+		log.Fatal(err)
 	}
-
-	log.Infof("Successfully reduced the occurrences in %.16s...", fmt.Sprintf("%v", shuffle))
-
-}
-func main() {
-	http.HandleFunc("/", reduceHandler)
-
-	http.ListenAndServe(":80", nil)
 }
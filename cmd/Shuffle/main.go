@@ -1,71 +1,67 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/internal/metrics"
+	"github.com/FDeRubeis/mapreduce/internal/rpc"
+	"github.com/FDeRubeis/mapreduce/internal/server"
+	"github.com/FDeRubeis/mapreduce/internal/tracing"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
-func shuffleHandler(w http.ResponseWriter, r *http.Request) {
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	if r.Method != http.MethodPost {
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-		log.Errorf("Request with method not allowed: %s", r.Method)
-		return
-	}
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		log.Errorf("Error reading request body: %s", err)
-		return
-	}
+	// serve tasks over HTTP and gRPC, both counting towards the load
+	mux := http.NewServeMux()
+	service := &server.Service{HTTP: &http.Server{Handler: mux}}
+	tasks := tracing.Handler("shuffle task", http.HandlerFunc(mapreduce.ShuffleHandler))
+	mux.Handle("/", service.Track(logging.Handler("shuffle", metrics.Instrument("shuffle", tasks))))
+	reduceTasks := tracing.Handler("shuffle task", http.HandlerFunc(mapreduce.ShuffleReduceHandler))
+	mux.Handle(mapreduce.ShuffleReducePath, service.Track(logging.Handler("shuffle", metrics.Instrument("shuffle", reduceTasks))))
+	service.GRPC = grpc.NewServer(
+		grpc.ChainStreamInterceptor(service.StreamInterceptor, tracing.StreamInterceptor, logging.StreamInterceptor("shuffle")),
+		grpc.StatsHandler(metrics.GRPCStats{Service: "shuffle"}),
+	)
+	rpc.RegisterShuffler(service.GRPC)
+	rpc.RegisterHealth(service.GRPC)
 
-	mappings := []map[string]int{}
-	if err = json.Unmarshal(body, &mappings); err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		log.Errorf("Error decoding JSON: %s", err)
-		return
+	settings := config.New("shuffle")
+	var logs logging.Config
+	var traces tracing.Config
+	logs.Register(settings)
+	traces.Register(settings)
+	service.Register(settings)
+	if err := settings.Load(os.Args[1:]); err != nil {
+		log.Fatal(err)
 	}
 
-	// compute shuffles
-	shuffles := map[string][]int{}
-	for _, mapping := range mappings {
+	logging.Setup(logs)
+	flushSpans, err := tracing.Setup(ctx, "shuffle", traces)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		// get first (and only) key from the mapping
-		var key string
-		for k := range mapping {
-			key = k
-			break
-		}
+	mux.HandleFunc("GET /healthz", service.HealthHandler)
+	mux.HandleFunc("GET /readyz", service.ReadyHandler)
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /debug/config", settings)
 
-		if _, ok := shuffles[key]; !ok {
-			shuffles[key] = []int{}
-		}
-		shuffles[key] = append(shuffles[key], mapping[key])
+	err = service.Run(ctx)
+	if err := flushSpans(context.Background()); err != nil {
+		log.Errorf("Error flushing the spans: %s", err)
 	}
-
-	// write response
-	w.Header().Set("Content-Type", "application/json")
-	shfl_marshaled, err := json.Marshal(shuffles)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		log.Errorf("Error encoding shuffles: %s", err)
-		return
+		log.Fatal(err)
 	}
-	if _, err := w.Write(shfl_marshaled); err != nil {
-		log.Errorf("Error writing response: %s", err)
-		return
-	}
-
-	log.Infof("Successfully shuffled the mappings in %.16s...", fmt.Sprintf("%v", mappings))
-
-}
-
-func main() {
-	http.HandleFunc("/", shuffleHandler)
-
-	http.ListenAndServe(":80", nil)
 }
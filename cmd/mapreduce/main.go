@@ -0,0 +1,244 @@
+// Command mapreduce runs a job in a single process, with goroutines as the
+// workers, and prints the result.
+//
+// Usage:
+//
+//	mapreduce [flags] [file or directory ...]
+//
+// The input is the concatenation of the files, with the files of directories
+// read recursively in lexical order, or stdin if no file or "-" is given.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/FDeRubeis/mapreduce/internal/job"
+	"github.com/FDeRubeis/mapreduce/internal/output"
+	"github.com/FDeRubeis/mapreduce/pkg/mapreduce"
+)
+
+// formats of the output, by flag value
+var formats = map[string]string{
+	"json":   output.JSON,
+	"csv":    output.CSV,
+	"tsv":    output.TSV,
+	"ndjson": output.NDJSON,
+}
+
+// paramsFlag collects the repeated -p key=value flags.
+type paramsFlag url.Values
+
+func (p paramsFlag) String() string {
+	return url.Values(p).Encode()
+}
+
+func (p paramsFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("parameter %q is not key=value", s)
+	}
+	url.Values(p).Add(key, value)
+	return nil
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+
+	flags := flag.NewFlagSet("mapreduce", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	name := flags.String("job", job.DefaultName, "job to run, one of: "+strings.Join(job.Names(), ", "))
+	workers := flags.Int("workers", runtime.NumCPU(), "number of workers of each phase")
+	taskBytes := flags.Int("task-bytes", mapreduce.DefaultTaskBytes, "maximum size of a map task in bytes")
+	combine := flags.Bool("combine", true, "combine the values of each key within a map task")
+	format := flags.String("format", "json", "output format: json, csv, tsv or ndjson")
+	order := flags.String("sort", "", "output order: key or count (default key, count for top-K queries)")
+	params := paramsFlag{}
+	flags.Var(params, "p", "job parameter as key=value, as in a request to the coordinator (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	j, err := mapreduce.Lookup(*name)
+	if err != nil {
+		return err
+	}
+	if *workers < 1 {
+		return fmt.Errorf("invalid workers: %d", *workers)
+	}
+	if *taskBytes < 1 {
+		return fmt.Errorf("invalid task-bytes: %d", *taskBytes)
+	}
+	mediaType, ok := formats[*format]
+	if !ok {
+		return fmt.Errorf("invalid format: %q", *format)
+	}
+	top, err := j.ParseTopK(url.Values(params))
+	if err != nil {
+		return err
+	}
+	switch *order {
+	case "":
+		*order = output.ByKey
+		if top != nil {
+			*order = output.ByCount
+		}
+	case output.ByKey, output.ByCount:
+	default:
+		return fmt.Errorf("invalid sort: %q", *order)
+	}
+	if !url.Values(params).Has("combine") {
+		url.Values(params).Set("combine", strconv.FormatBool(*combine))
+	}
+
+	input, err := openInput(flags.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	engine := &mapreduce.Engine{
+		Params:       url.Values(params),
+		TaskBytes:    *taskBytes,
+		ShuffleTasks: *workers,
+		ReduceTasks:  *workers,
+		Workers:      *workers,
+	}
+	result, err := engine.Run(ctx, j, input)
+	if err != nil {
+		return err
+	}
+
+	rows, err := output.Sort(result, *order)
+	if err != nil {
+		return err
+	}
+	if err := output.Encode(stdout, mediaType, rows, top != nil); err != nil {
+		return err
+	}
+	// CSV, TSV and NDJSON end with a line break already
+	if mediaType == output.JSON {
+		_, err = io.WriteString(stdout, "\n")
+	}
+	return err
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mapreduce: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// openInput returns the input named by the arguments. Directories are walked
+// to list their files upfront, but the files are only opened when read.
+func openInput(args []string, stdin io.Reader) (io.ReadCloser, error) {
+
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	paths := []string{}
+	for _, arg := range args {
+		if arg == "-" {
+			paths = append(paths, arg)
+			continue
+		}
+		err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &files{paths: paths, stdin: stdin}, nil
+}
+
+// files reads the files one after the other, with a line break between
+// them so that the last line of a file does not run into the next one.
+type files struct {
+	paths []string
+	stdin io.Reader
+	cur   io.Reader
+	// closer closes cur, if it is a file
+	closer io.Closer
+	// sep is whether a line break is due before the next file
+	sep bool
+}
+
+func (f *files) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		if f.cur == nil {
+			if len(f.paths) == 0 {
+				return 0, io.EOF
+			}
+			if f.sep {
+				f.sep = false
+				p[0] = '\n'
+				return 1, nil
+			}
+
+			path := f.paths[0]
+			f.paths = f.paths[1:]
+			if path == "-" {
+				f.cur = f.stdin
+			} else {
+				file, err := os.Open(path)
+				if err != nil {
+					return 0, err
+				}
+				f.cur, f.closer = file, file
+			}
+		}
+
+		n, err := f.cur.Read(p)
+		if errors.Is(err, io.EOF) {
+			f.sep = true
+			if cerr := f.Close(); cerr != nil {
+				return n, cerr
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close closes the file being read.
+func (f *files) Close() error {
+	f.cur = nil
+	if f.closer == nil {
+		return nil
+	}
+	err := f.closer.Close()
+	f.closer = nil
+	return err
+}
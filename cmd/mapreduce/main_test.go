@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_run(t *testing.T) {
+
+	dir := t.TempDir()
+	if !assert.NoError(t, os.MkdirAll(filepath.Join(dir, "docs", "more"), 0o755)) {
+		return
+	}
+	docs := map[string]string{
+		"a.txt":           "lorem ipsum",
+		"docs/b.txt":      "dolor sit\nlorem",
+		"docs/more/c.txt": "lorem dolor",
+	}
+	for name, content := range docs {
+		if !assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)) {
+			return
+		}
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "test stdin",
+			stdin: "lorem ipsum lorem",
+			want:  `{"ipsum":1,"lorem":2}` + "\n",
+		},
+		{
+			name: "test files and directories",
+			args: []string{"-workers", "2", "-task-bytes", "8", filepath.Join(dir, "a.txt"), filepath.Join(dir, "docs")},
+			want: `{"dolor":2,"ipsum":1,"lorem":3,"sit":1}` + "\n",
+		},
+		{
+			name:  "test files and stdin",
+			args:  []string{filepath.Join(dir, "a.txt"), "-"},
+			stdin: "ipsum",
+			want:  `{"ipsum":2,"lorem":1}` + "\n",
+		},
+		{
+			name:  "test csv by count",
+			args:  []string{"-format", "csv", "-sort", "count"},
+			stdin: "lorem ipsum lorem",
+			want:  "key,value\nlorem,2\nipsum,1\n",
+		},
+		{
+			name:  "test top k",
+			args:  []string{"-p", "top=1"},
+			stdin: "lorem ipsum lorem",
+			want:  `[{"key":"lorem","count":2}]` + "\n",
+		},
+		{
+			name:  "test job parameters",
+			args:  []string{"-job", "grep", "-p", "pattern=sit"},
+			stdin: "lorem ipsum\ndolor sit",
+			want:  `{"dolor sit":1}` + "\n",
+		},
+		{
+			name:    "test unknown job",
+			args:    []string{"-job", "gibberish"},
+			wantErr: true,
+		},
+		{
+			name:    "test invalid format",
+			args:    []string{"-format", "xml"},
+			wantErr: true,
+		},
+		{
+			name:    "test invalid parameter",
+			args:    []string{"-p", "top"},
+			wantErr: true,
+		},
+		{
+			name:    "test missing file",
+			args:    []string{filepath.Join(dir, "gibberish.txt")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			err := run(context.Background(), tt.args, strings.NewReader(tt.stdin), stdout, stderr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, stdout.String())
+			}
+		})
+	}
+}
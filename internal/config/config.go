@@ -0,0 +1,313 @@
+// Package config loads the settings of a service from the command line, the
+// environment and an optional file, and validates them at startup.
+//
+// A setting named "task-max-attempts" is set by the flag -task-max-attempts,
+// the environment variable TASK_MAX_ATTEMPTS or the key task_max_attempts of
+// the file, in this order of precedence. The file is named by -config-file or
+// CONFIG_FILE, and is TOML, or YAML if its extension is .yaml or .yml.
+// Empty environment variables are ignored, as if unset.
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// sources of the settings
+const (
+	Default = "default"
+	File    = "file"
+	Env     = "env"
+	Flag    = "flag"
+)
+
+// fileSetting is the setting of the configuration file.
+const fileSetting = "config-file"
+
+// Set is the set of the settings of a service. Settings are registered on
+// it, like flags on a flag.FlagSet, and set by Load.
+type Set struct {
+	flags    *flag.FlagSet
+	settings []*setting
+	file     string
+	// parsing is set while the command line is parsed.
+	parsing bool
+}
+
+// setting is a registered setting, which records the source of its value.
+type setting struct {
+	flag.Value
+	set      *Set
+	name     string
+	def      string
+	required bool
+	source   string
+}
+
+func (st *setting) Set(v string) error {
+	if err := st.Value.Set(v); err != nil {
+		return err
+	}
+	if st.set.parsing {
+		st.source = Flag
+	}
+	return nil
+}
+
+func (st *setting) String() string {
+	if st == nil || st.Value == nil {
+		return ""
+	}
+	return st.Value.String()
+}
+
+func (st *setting) IsBoolFlag() bool {
+	b, ok := st.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// New returns an empty set of settings for the service.
+func New(service string) *Set {
+	s := &Set{flags: flag.NewFlagSet(service, flag.ContinueOnError)}
+	s.StringVar(&s.file, fileSetting, "", "configuration file, TOML or YAML")
+	return s
+}
+
+// EnvName returns the environment variable of a setting.
+func EnvName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// FileKey returns the key of a setting in the configuration file.
+func FileKey(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// lookup returns the setting with the name, or nil.
+func (s *Set) lookup(name string) *setting {
+	for _, st := range s.settings {
+		if st.name == name {
+			return st
+		}
+	}
+	return nil
+}
+
+// stdValue returns the flag.Value that define gives to a flag of the
+// standard library, which has no exported value types.
+func stdValue(define func(fs *flag.FlagSet)) flag.Value {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	define(fs)
+	var v flag.Value
+	fs.VisitAll(func(f *flag.Flag) { v = f.Value })
+	return v
+}
+
+// StringVar registers a string setting stored in p.
+func (s *Set) StringVar(p *string, name, value, usage string) {
+	s.Var(stdValue(func(fs *flag.FlagSet) { fs.StringVar(p, name, value, usage) }), name, usage)
+}
+
+// BoolVar registers a boolean setting stored in p.
+func (s *Set) BoolVar(p *bool, name string, value bool, usage string) {
+	s.Var(stdValue(func(fs *flag.FlagSet) { fs.BoolVar(p, name, value, usage) }), name, usage)
+}
+
+// IntVar registers an integer setting stored in p, which cannot be less than
+// min.
+func (s *Set) IntVar(p *int, name string, value, min int, usage string) {
+	*p = value
+	s.Var(&intValue{p: p, min: min}, name, usage)
+}
+
+// FloatVar registers a number setting stored in p, which must be between min
+// and max.
+func (s *Set) FloatVar(p *float64, name string, value, min, max float64, usage string) {
+	*p = value
+	s.Var(&floatValue{p: p, min: min, max: max}, name, usage)
+}
+
+// PortVar registers a TCP port setting stored in p.
+func (s *Set) PortVar(p *int, name string, value int, usage string) {
+	*p = value
+	s.Var(&portValue{p: p}, name, usage)
+}
+
+// DurationVar registers a duration setting stored in p, which cannot be
+// negative.
+func (s *Set) DurationVar(p *time.Duration, name string, value time.Duration, usage string) {
+	*p = value
+	s.Var(&durationValue{p: p}, name, usage)
+}
+
+// EnumVar registers a string setting stored in p, which must be one of
+// choices.
+func (s *Set) EnumVar(p *string, name, value string, choices []string, usage string) {
+	*p = value
+	s.Var(&enumValue{p: p, choices: choices}, name, usage+" (one of "+strings.Join(choices, ", ")+")")
+}
+
+// AddrVar registers a host:port address setting stored in p, such as a
+// listen address.
+func (s *Set) AddrVar(p *string, name, value, usage string) {
+	*p = value
+	s.Var(&addrValue{p: p}, name, usage)
+}
+
+// TextVar registers a setting stored in p, parsed with its UnmarshalText
+// method.
+func (s *Set) TextVar(p encoding.TextUnmarshaler, name string, value encoding.TextMarshaler, usage string) {
+	s.Var(stdValue(func(fs *flag.FlagSet) { fs.TextVar(p, name, value, usage) }), name, usage)
+}
+
+// Var registers a setting of any type stored in v. Its current value is the
+// default, and must be valid, since Reset sets it again.
+func (s *Set) Var(v flag.Value, name, usage string) {
+	st := &setting{Value: v, set: s, name: name, def: v.String(), source: Default}
+	s.flags.Var(st, name, fmt.Sprintf("%s ($%s)", usage, EnvName(name)))
+	s.settings = append(s.settings, st)
+}
+
+// Require marks a registered setting as required: Load fails unless a
+// source sets it.
+func (s *Set) Require(name string) {
+	if st := s.lookup(name); st != nil {
+		st.required = true
+	}
+}
+
+// Reset sets the settings back to their defaults.
+func (s *Set) Reset() {
+	for _, st := range s.settings {
+		st.Value.Set(st.def)
+		st.source = Default
+	}
+}
+
+// Load sets the settings from the command line arguments, the environment
+// and the configuration file, after resetting them to their defaults. It
+// reports all the invalid, unknown and missing settings at once.
+func (s *Set) Load(args []string) error {
+
+	s.Reset()
+
+	s.parsing = true
+	err := s.flags.Parse(args)
+	s.parsing = false
+	if err != nil {
+		return err
+	}
+	if s.flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(s.flags.Args(), " "))
+	}
+
+	var errs []error
+	for _, st := range s.settings {
+		if st.source != Default {
+			continue
+		}
+		name := EnvName(st.name)
+		if v := os.Getenv(name); v != "" {
+			if err := st.Value.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %s: %w", name, v, err))
+			}
+			st.source = Env
+		}
+	}
+
+	if s.file != "" {
+		errs = append(errs, s.loadFile(s.file)...)
+	}
+
+	for _, st := range s.settings {
+		if st.required && st.source == Default {
+			errs = append(errs, fmt.Errorf("missing %s: set -%s, %s or %s in the configuration file", st.name, st.name, EnvName(st.name), FileKey(st.name)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// loadFile sets the settings that are not set on the command line or in the
+// environment from the file.
+func (s *Set) loadFile(path string) []error {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("reading the configuration file: %w", err)}
+	}
+
+	values := map[string]any{}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		err = toml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return []error{fmt.Errorf("parsing %s: %w", path, err)}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		value := values[key]
+		st := s.lookup(strings.ReplaceAll(key, "_", "-"))
+		if st == nil || st.name == fileSetting || FileKey(st.name) != key {
+			errs = append(errs, fmt.Errorf("unknown setting %s in %s", key, path))
+			continue
+		}
+		if st.source != Default {
+			continue
+		}
+		switch value.(type) {
+		case map[string]any, []any:
+			errs = append(errs, fmt.Errorf("invalid %s in %s: not a single value", key, path))
+			continue
+		}
+		v := fmt.Sprint(value)
+		if err := st.Value.Set(v); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s in %s: %s: %w", key, path, v, err))
+		}
+		st.source = File
+	}
+	return errs
+}
+
+// effective is the value of a setting and where it comes from.
+type effective struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// ServeHTTP writes the effective settings as a JSON object, keyed by name.
+func (s *Set) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	settings := make(map[string]effective, len(s.settings))
+	for _, st := range s.settings {
+		settings[st.name] = effective{Value: st.String(), Source: st.source}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		log.Errorf("Error writing the settings: %s", err)
+	}
+}
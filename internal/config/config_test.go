@@ -0,0 +1,201 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testConfig is a configuration with a setting of each type.
+type testConfig struct {
+	name     string
+	workers  int
+	share    float64
+	port     int
+	timeout  time.Duration
+	mode     string
+	addr     string
+	combine  bool
+	required int
+}
+
+func (c *testConfig) register(s *Set) {
+	s.StringVar(&c.name, "svc-name", "map", "name of the service")
+	s.IntVar(&c.workers, "workers-num", 3, 1, "number of workers")
+	s.FloatVar(&c.share, "hot-key-share", 0, 0, 1, "share of a hot key")
+	s.PortVar(&c.port, "svc-port", 80, "port of the service")
+	s.DurationVar(&c.timeout, "job-timeout", time.Minute, "deadline of the jobs")
+	s.EnumVar(&c.mode, "split-mode", "bytes", []string{"bytes", "lines"}, "split mode")
+	s.AddrVar(&c.addr, "http-addr", ":80", "listen address")
+	s.BoolVar(&c.combine, "map-combine", false, "combine the mappings")
+	s.IntVar(&c.required, "required-num", 0, 0, "a required setting")
+	s.Require("required-num")
+}
+
+// writeFile writes a configuration file in the temporary directory of the
+// test.
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_Set_Load(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string
+		content string
+		want    testConfig
+		wantErr string
+	}{
+		{
+			name: "test defaults",
+			env:  map[string]string{"REQUIRED_NUM": "1"},
+			want: testConfig{name: "map", workers: 3, port: 80, timeout: time.Minute, mode: "bytes", addr: ":80", required: 1},
+		},
+		{
+			name: "test environment",
+			env: map[string]string{
+				"SVC_NAME":      "mapper",
+				"WORKERS_NUM":   "10",
+				"HOT_KEY_SHARE": "0.1",
+				"SVC_PORT":      "8080",
+				"JOB_TIMEOUT":   "30m",
+				"SPLIT_MODE":    "lines",
+				"HTTP_ADDR":     "127.0.0.1:8080",
+				"MAP_COMBINE":   "true",
+				"REQUIRED_NUM":  "2",
+			},
+			want: testConfig{name: "mapper", workers: 10, share: 0.1, port: 8080, timeout: 30 * time.Minute, mode: "lines", addr: "127.0.0.1:8080", combine: true, required: 2},
+		},
+		{
+			name: "test flags over environment",
+			args: []string{"-workers-num", "5", "-map-combine", "-required-num=4"},
+			env:  map[string]string{"WORKERS_NUM": "10", "REQUIRED_NUM": "2"},
+			want: testConfig{name: "map", workers: 5, port: 80, timeout: time.Minute, mode: "bytes", addr: ":80", combine: true, required: 4},
+		},
+		{
+			name:    "test TOML file under environment",
+			env:     map[string]string{"WORKERS_NUM": "10"},
+			file:    "coordinator.toml",
+			content: "workers_num = 7\njob_timeout = \"10m\"\nsplit_mode = \"lines\"\nmap_combine = true\nrequired_num = 1\n",
+			want:    testConfig{name: "map", workers: 10, port: 80, timeout: 10 * time.Minute, mode: "lines", addr: ":80", combine: true, required: 1},
+		},
+		{
+			name:    "test YAML file",
+			file:    "coordinator.yaml",
+			content: "svc_name: mapper\nsvc_port: 8080\nrequired_num: 1\n",
+			want:    testConfig{name: "mapper", workers: 3, port: 8080, timeout: time.Minute, mode: "bytes", addr: ":80", required: 1},
+		},
+		{
+			name: "test all errors at once",
+			env:  map[string]string{"WORKERS_NUM": "0", "HOT_KEY_SHARE": "2", "SVC_PORT": "http", "JOB_TIMEOUT": "-1s", "SPLIT_MODE": "words", "HTTP_ADDR": "80"},
+			wantErr: "invalid WORKERS_NUM: 0: must be at least 1\n" +
+				"invalid HOT_KEY_SHARE: 2: must be between 0 and 1\n" +
+				"invalid SVC_PORT: http: not a port\n" +
+				"invalid JOB_TIMEOUT: -1s: must not be negative\n" +
+				"invalid SPLIT_MODE: words: must be one of bytes, lines\n" +
+				"invalid HTTP_ADDR: 80: not a host:port address\n" +
+				"missing required-num: set -required-num, REQUIRED_NUM or required_num in the configuration file",
+		},
+		{
+			name:    "test invalid file",
+			env:     map[string]string{"REQUIRED_NUM": "1"},
+			file:    "coordinator.toml",
+			content: "workers_num = 0\nshuffle_num = 3\n[map]\nsvc_name = \"map\"\n",
+			wantErr: "unknown setting map in $FILE\n" +
+				"unknown setting shuffle_num in $FILE\n" +
+				"invalid workers_num in $FILE: 0: must be at least 1",
+		},
+		{
+			name:    "test invalid flag",
+			args:    []string{"-split-mode", "words"},
+			wantErr: `invalid value "words" for flag -split-mode: must be one of bytes, lines`,
+		},
+		{
+			name:    "test unexpected arguments",
+			args:    []string{"-workers-num", "5", "lorem"},
+			wantErr: "unexpected arguments: lorem",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"CONFIG_FILE", "SVC_NAME", "WORKERS_NUM", "HOT_KEY_SHARE", "SVC_PORT", "JOB_TIMEOUT", "SPLIT_MODE", "HTTP_ADDR", "MAP_COMBINE", "REQUIRED_NUM"} {
+				t.Setenv(name, tt.env[name])
+			}
+			wantErr := tt.wantErr
+			if tt.file != "" {
+				path := writeFile(t, tt.file, tt.content)
+				t.Setenv("CONFIG_FILE", path)
+				wantErr = os.Expand(wantErr, func(string) string { return path })
+			}
+
+			var got testConfig
+			s := New("test")
+			s.flags.SetOutput(io.Discard)
+			got.register(s)
+			err := s.Load(tt.args)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_Set_Reset(t *testing.T) {
+	var got testConfig
+	s := New("test")
+	got.register(s)
+
+	t.Setenv("WORKERS_NUM", "10")
+	assert.NoError(t, s.Load([]string{"-svc-port", "8080", "-required-num", "1"}))
+	assert.Equal(t, 10, got.workers)
+	assert.Equal(t, 8080, got.port)
+
+	// a reload only keeps what is still set
+	t.Setenv("WORKERS_NUM", "")
+	assert.NoError(t, s.Load([]string{"-required-num", "1"}))
+	assert.Equal(t, 3, got.workers)
+	assert.Equal(t, 80, got.port)
+}
+
+func Test_Set_ServeHTTP(t *testing.T) {
+	var c testConfig
+	s := New("test")
+	c.register(s)
+
+	t.Setenv("CONFIG_FILE", writeFile(t, "coordinator.toml", "svc_port = 8080\n"))
+	t.Setenv("WORKERS_NUM", "10")
+	if err := s.Load([]string{"-required-num", "1"}); !assert.NoError(t, err) {
+		return
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	got := map[string]effective{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, effective{Value: "map", Source: Default}, got["svc-name"])
+	assert.Equal(t, effective{Value: "10", Source: Env}, got["workers-num"])
+	assert.Equal(t, effective{Value: "8080", Source: File}, got["svc-port"])
+	assert.Equal(t, effective{Value: "1m0s", Source: Default}, got["job-timeout"])
+	assert.Equal(t, effective{Value: "1", Source: Flag}, got["required-num"])
+	assert.Equal(t, Env, got["config-file"].Source)
+}
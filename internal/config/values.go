@@ -0,0 +1,152 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// intValue is an integer of at least min.
+type intValue struct {
+	p   *int
+	min int
+}
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.New("not an integer")
+	}
+	if n < v.min {
+		return fmt.Errorf("must be at least %d", v.min)
+	}
+	*v.p = n
+	return nil
+}
+
+func (v *intValue) String() string {
+	if v == nil || v.p == nil {
+		return ""
+	}
+	return strconv.Itoa(*v.p)
+}
+
+// floatValue is a number between min and max.
+type floatValue struct {
+	p        *float64
+	min, max float64
+}
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return errors.New("not a number")
+	}
+	if f < v.min || f > v.max {
+		return fmt.Errorf("must be between %g and %g", v.min, v.max)
+	}
+	*v.p = f
+	return nil
+}
+
+func (v *floatValue) String() string {
+	if v == nil || v.p == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v.p, 'g', -1, 64)
+}
+
+// portValue is a TCP port.
+type portValue struct {
+	p *int
+}
+
+func (v *portValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 65535 {
+		return errors.New("not a port")
+	}
+	*v.p = n
+	return nil
+}
+
+func (v *portValue) String() string {
+	if v == nil || v.p == nil {
+		return ""
+	}
+	return strconv.Itoa(*v.p)
+}
+
+// durationValue is a non-negative duration.
+type durationValue struct {
+	p *time.Duration
+}
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New("not a duration")
+	}
+	if d < 0 {
+		return errors.New("must not be negative")
+	}
+	*v.p = d
+	return nil
+}
+
+func (v *durationValue) String() string {
+	if v == nil || v.p == nil {
+		return ""
+	}
+	return v.p.String()
+}
+
+// enumValue is one of a set of strings.
+type enumValue struct {
+	p       *string
+	choices []string
+}
+
+func (v *enumValue) Set(s string) error {
+	for _, choice := range v.choices {
+		if s == choice {
+			*v.p = s
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(v.choices, ", "))
+}
+
+func (v *enumValue) String() string {
+	if v == nil || v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+// addrValue is a host:port address, whose host may be empty.
+type addrValue struct {
+	p *string
+}
+
+func (v *addrValue) Set(s string) error {
+	_, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return errors.New("not a host:port address")
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil {
+		return errors.New("not a host:port address")
+	}
+	*v.p = s
+	return nil
+}
+
+func (v *addrValue) String() string {
+	if v == nil || v.p == nil {
+		return ""
+	}
+	return *v.p
+}
@@ -0,0 +1,44 @@
+package job
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+)
+
+func init() {
+	Register(&Job{
+		Name:    "grep",
+		Map:     grepMap,
+		Combine: sum,
+		Reduce:  sum,
+		Counts:  true,
+	})
+}
+
+// grepMap emits the lines of the content that match the regular expression
+// in the "pattern" parameter. The final result counts how many times each
+// matching line occurs in the document.
+func grepMap(content string, params url.Values) ([]kv.KV, error) {
+
+	pattern := params.Get("pattern")
+	if pattern == "" {
+		return nil, errors.New("grep: missing pattern")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := []kv.KV{}
+	for _, line := range strings.Split(content, "\n") {
+		if re.MatchString(line) {
+			pairs = append(pairs, kv.KV{Key: line, Value: one})
+		}
+	}
+
+	return pairs, nil
+}
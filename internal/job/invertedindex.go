@@ -0,0 +1,81 @@
+package job
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"github.com/FDeRubeis/mapreduce/internal/tokenize"
+)
+
+func init() {
+	Register(&Job{
+		Name:    "invertedindex",
+		Map:     invertedIndexMap,
+		Combine: mergeIDs,
+		Reduce:  mergeIDs,
+	})
+}
+
+// invertedIndexMap treats each line of the content as a document whose ID is
+// the first field of the line. It maps every word of the document to the ID,
+// so that the final result lists the documents containing each word. Words are
+// tokenized and filtered as in the wordcount job.
+func invertedIndexMap(content string, params url.Values) ([]kv.KV, error) {
+
+	tokenizer, err := tokenize.FromParams(params)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := tokenize.FilterFromParams(params, tokenizer)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := []kv.KV{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		id, err := json.Marshal([]string{fields[0]})
+		if err != nil {
+			return nil, err
+		}
+
+		text := strings.Join(fields[1:], " ")
+		for _, word := range tokenizer.Tokens(text) {
+			if !filter.Keep(word) {
+				continue
+			}
+			pairs = append(pairs, kv.KV{Key: word, Value: id})
+		}
+	}
+
+	return pairs, nil
+}
+
+// mergeIDs merges lists of document IDs into a sorted list without duplicates.
+func mergeIDs(_ string, values []json.RawMessage) (json.RawMessage, error) {
+	seen := map[string]bool{}
+	for _, value := range values {
+		var ids []string
+		if err := json.Unmarshal(value, &ids); err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			seen[id] = true
+		}
+	}
+
+	merged := make([]string, 0, len(seen))
+	for id := range seen {
+		merged = append(merged, id)
+	}
+	sort.Strings(merged)
+
+	return json.Marshal(merged)
+}
@@ -0,0 +1,165 @@
+// Package job defines the MapReduce jobs that the services can run.
+//
+// A job supplies the map, reduce and (optionally) combine functions of a
+// computation. Jobs register themselves by name and the services look them up
+// from the "job" query parameter of each request.
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+)
+
+// DefaultName is the job run when a request does not name one.
+const DefaultName = "wordcount"
+
+// Job is a MapReduce computation.
+type Job struct {
+	Name string
+
+	// Map emits the intermediate pairs for a chunk of the input document.
+	// params holds the query parameters of the request, so that jobs can
+	// be configured by the client.
+	Map func(content string, params url.Values) ([]kv.KV, error)
+
+	// Combine pre-aggregates the values of a key within a single map task,
+	// to reduce the mappings sent to the shuffle phase. It is optional and,
+	// when set, it must be compatible with Reduce: reducing the combined
+	// values must give the same result as reducing the original ones.
+	Combine func(key string, values []json.RawMessage) (json.RawMessage, error)
+
+	// Reduce computes the final value of a key from all its values.
+	Reduce func(key string, values []json.RawMessage) (json.RawMessage, error)
+
+	// Counts tells whether the final values are integer counts, which
+	// top-K queries rank the keys by.
+	Counts bool
+}
+
+var registry = map[string]*Job{}
+
+// Register makes a job available by name. It panics if the job is incomplete
+// or if a job with the same name is already registered.
+func Register(j *Job) {
+	if j.Name == "" || j.Map == nil || j.Reduce == nil {
+		panic("job: Register of incomplete job")
+	}
+	if _, ok := registry[j.Name]; ok {
+		panic("job: Register called twice for job " + j.Name)
+	}
+	registry[j.Name] = j
+}
+
+// Lookup returns the job registered with the given name. An empty name
+// selects the default job.
+func Lookup(name string) (*Job, error) {
+	if name == "" {
+		name = DefaultName
+	}
+	j, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown job: %q", name)
+	}
+	return j, nil
+}
+
+// Names returns the names of all registered jobs, sorted.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunMap computes the intermediate pairs of a map task. If the "combine"
+// parameter is true and the job has a combiner, the values of each key are
+// combined into a single pair.
+func (j *Job) RunMap(content string, params url.Values) ([]kv.KV, error) {
+
+	pairs, err := j.Map(content, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return j.RunCombine(pairs, params)
+}
+
+// RunCombine combines the values of each key of the pairs of a map task into
+// a single pair, if the "combine" parameter is true and the job has a
+// combiner. Otherwise, it returns the pairs unchanged.
+func (j *Job) RunCombine(pairs []kv.KV, params url.Values) ([]kv.KV, error) {
+
+	combine := false
+	if v := params.Get("combine"); v != "" {
+		var err error
+		if combine, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid combine parameter: %q", v)
+		}
+	}
+	if !combine || j.Combine == nil {
+		return pairs, nil
+	}
+
+	groups := kv.Group(pairs)
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	combined := make([]kv.KV, 0, len(keys))
+	for _, key := range keys {
+		value, err := j.Combine(key, groups[key])
+		if err != nil {
+			return nil, err
+		}
+		combined = append(combined, kv.KV{Key: key, Value: value})
+	}
+
+	return combined, nil
+}
+
+// ParseTopK reads the top-K query of the parameters, like the ParseTopK
+// function. It returns an error if the job does not count its keys.
+func (j *Job) ParseTopK(params url.Values) (*TopK, error) {
+
+	top, err := ParseTopK(params)
+	if err != nil {
+		return nil, err
+	}
+	if top != nil && !j.Counts {
+		return nil, fmt.Errorf("top: job %q does not count its keys", j.Name)
+	}
+	return top, nil
+}
+
+// RunReduce computes the final value of each key of a reduce task. If the
+// parameters ask for the top K keys, it only returns the top K of the task.
+func (j *Job) RunReduce(groups map[string][]json.RawMessage, params url.Values) (map[string]json.RawMessage, error) {
+
+	top, err := j.ParseTopK(params)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]json.RawMessage, len(groups))
+	for key, values := range groups {
+		value, err := j.Reduce(key, values)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+
+	if top != nil {
+		return top.Select(result)
+	}
+	return result, nil
+}
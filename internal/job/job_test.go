@@ -0,0 +1,300 @@
+package job
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Lookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "test default job",
+			job:  "",
+			want: "wordcount",
+		},
+		{
+			name: "test registered job",
+			job:  "grep",
+			want: "grep",
+		},
+		{
+			name:    "test unknown job",
+			job:     "unknown",
+			wantErr: `unknown job: "unknown"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Lookup(tt.job)
+			if err != nil {
+				assert.EqualErrorf(t, err, tt.wantErr, "Lookup() = %q, want %q", err.Error(), tt.wantErr)
+				return
+			}
+			if got.Name != tt.want {
+				t.Errorf("Lookup() = %v, want %v", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func Test_RunMap(t *testing.T) {
+	type args struct {
+		job     string
+		content string
+		params  url.Values
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []kv.KV
+		wantErr string
+	}{
+		{
+			name: "test word count",
+			args: args{
+				job:     "wordcount",
+				content: "Lorem lorem,\nipsum!",
+			},
+			want: []kv.KV{
+				{Key: "lorem", Value: one},
+				{Key: "lorem", Value: one},
+				{Key: "ipsum", Value: one},
+			},
+		},
+		{
+			name: "test word count with combiner",
+			args: args{
+				job:     "wordcount",
+				content: "Lorem lorem,\nipsum!",
+				params:  url.Values{"combine": {"true"}},
+			},
+			want: []kv.KV{
+				{Key: "ipsum", Value: one},
+				{Key: "lorem", Value: json.RawMessage("2")},
+			},
+		},
+		{
+			name: "test invalid combine parameter",
+			args: args{
+				job:     "wordcount",
+				content: "Lorem lorem,\nipsum!",
+				params:  url.Values{"combine": {"maybe"}},
+			},
+			wantErr: `invalid combine parameter: "maybe"`,
+		},
+		{
+			name: "test word count unicode tokenizer",
+			args: args{
+				job:     "wordcount",
+				content: "Don’t STRASSE—Straße",
+				params:  url.Values{"tokenizer": {"unicode"}},
+			},
+			want: []kv.KV{
+				{Key: "don't", Value: one},
+				{Key: "strasse", Value: one},
+				{Key: "strasse", Value: one},
+			},
+		},
+		{
+			name: "test word count invalid tokenizer",
+			args: args{
+				job:     "wordcount",
+				content: "Lorem lorem,\nipsum!",
+				params:  url.Values{"tokenizer": {"bpe"}},
+			},
+			wantErr: `invalid tokenizer parameter: "bpe"`,
+		},
+		{
+			name: "test word count stop words",
+			args: args{
+				job:     "wordcount",
+				content: "The lorem and the ipsum",
+				params:  url.Values{"stopwords": {"en"}},
+			},
+			want: []kv.KV{
+				{Key: "lorem", Value: one},
+				{Key: "ipsum", Value: one},
+			},
+		},
+		{
+			name: "test word count bigrams",
+			args: args{
+				job:     "wordcount",
+				content: "Lorem ipsum dolor.\nSit amet",
+				params:  url.Values{"ngrams": {"2"}, "combine": {"true"}},
+			},
+			want: []kv.KV{
+				{Key: "ipsum dolor", Value: one},
+				{Key: "lorem ipsum", Value: one},
+				{Key: "sit amet", Value: one},
+			},
+		},
+		{
+			name: "test word count invalid ngrams",
+			args: args{
+				job:     "wordcount",
+				content: "Lorem ipsum",
+				params:  url.Values{"ngrams": {"0"}},
+			},
+			wantErr: `invalid ngrams parameter: "0"`,
+		},
+		{
+			name: "test grep",
+			args: args{
+				job:     "grep",
+				content: "lorem ipsum\ndolor sit\nlorem ipsum",
+				params:  url.Values{"pattern": {"ips"}},
+			},
+			want: []kv.KV{
+				{Key: "lorem ipsum", Value: one},
+				{Key: "lorem ipsum", Value: one},
+			},
+		},
+		{
+			name: "test grep invalid pattern",
+			args: args{
+				job:     "grep",
+				content: "lorem ipsum",
+				params:  url.Values{"pattern": {"("}},
+			},
+			wantErr: "error parsing regexp: missing closing ): `(`",
+		},
+		{
+			name: "test inverted index",
+			args: args{
+				job:     "invertedindex",
+				content: "doc2 Lorem ipsum lorem\ndoc1 ipsum",
+				params:  url.Values{"combine": {"true"}},
+			},
+			want: []kv.KV{
+				{Key: "ipsum", Value: json.RawMessage(`["doc1","doc2"]`)},
+				{Key: "lorem", Value: json.RawMessage(`["doc2"]`)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := Lookup(tt.args.job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := j.RunMap(tt.args.content, tt.args.params)
+			if err != nil {
+				assert.EqualErrorf(t, err, tt.wantErr, "RunMap() = %q, want %q", err.Error(), tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RunMap() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_RunReduce(t *testing.T) {
+	type args struct {
+		job    string
+		groups map[string][]json.RawMessage
+		params url.Values
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    map[string]json.RawMessage
+		wantErr string
+	}{
+		{
+			name: "test word count",
+			args: args{
+				job: "wordcount",
+				groups: map[string][]json.RawMessage{
+					"lorem": {one, json.RawMessage("2")},
+					"ipsum": {one},
+				},
+			},
+			want: map[string]json.RawMessage{
+				"lorem": json.RawMessage("3"),
+				"ipsum": json.RawMessage("1"),
+			},
+		},
+		{
+			name: "test inverted index",
+			args: args{
+				job: "invertedindex",
+				groups: map[string][]json.RawMessage{
+					"lorem": {json.RawMessage(`["doc2"]`), json.RawMessage(`["doc1","doc2"]`)},
+				},
+			},
+			want: map[string]json.RawMessage{
+				"lorem": json.RawMessage(`["doc1","doc2"]`),
+			},
+		},
+		{
+			name: "test top k",
+			args: args{
+				job: "wordcount",
+				groups: map[string][]json.RawMessage{
+					"lorem": {one, json.RawMessage("2")},
+					"ipsum": {one},
+					"dolor": {one, one},
+				},
+				params: url.Values{"top": {"2"}},
+			},
+			want: map[string]json.RawMessage{
+				"lorem": json.RawMessage("3"),
+				"dolor": json.RawMessage("2"),
+			},
+		},
+		{
+			name: "test invalid top k",
+			args: args{
+				job:    "wordcount",
+				params: url.Values{"top": {"all"}},
+			},
+			wantErr: `invalid top parameter: "all"`,
+		},
+		{
+			name: "test top k of job without counts",
+			args: args{
+				job:    "invertedindex",
+				params: url.Values{"top": {"2"}},
+			},
+			wantErr: `top: job "invertedindex" does not count its keys`,
+		},
+		{
+			name: "test bad value",
+			args: args{
+				job: "wordcount",
+				groups: map[string][]json.RawMessage{
+					"lorem": {json.RawMessage(`"one"`)},
+				},
+			},
+			wantErr: "json: cannot unmarshal string into Go value of type int",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := Lookup(tt.args.job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := j.RunReduce(tt.args.groups, tt.args.params)
+			if err != nil {
+				assert.EqualErrorf(t, err, tt.wantErr, "RunReduce() = %q, want %q", err.Error(), tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RunReduce() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
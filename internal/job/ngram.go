@@ -0,0 +1,82 @@
+package job
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxNgram is the longest n-gram that can be counted.
+const maxNgram = 10
+
+// ngramRange parses the ngrams parameter, either a single n such as "2" or a
+// range such as "1-3". The default is unigrams only.
+func ngramRange(param string) (int, int, error) {
+
+	if param == "" {
+		return 1, 1, nil
+	}
+
+	lo, hi, isRange := strings.Cut(param, "-")
+	if !isRange {
+		hi = lo
+	}
+	minN, err1 := strconv.Atoi(lo)
+	maxN, err2 := strconv.Atoi(hi)
+	if err1 != nil || err2 != nil || minN < 1 || maxN < minN || maxN > maxNgram {
+		return 0, 0, fmt.Errorf("invalid ngrams parameter: %q", param)
+	}
+
+	return minN, maxN, nil
+}
+
+// sentenceEnd matches the punctuation that ends a sentence.
+var sentenceEnd = regexp.MustCompile(`[.!?…]+(\s+|$)|[。！？]`)
+
+// segments splits the content at the boundaries that n-grams do not cross:
+// lines by default, or sentences and blank lines if boundary is "sentence".
+func segments(content string, boundary string) ([]string, error) {
+
+	switch boundary {
+	case "", "line":
+		return strings.Split(content, "\n"), nil
+	case "sentence":
+		var parts []string
+		for _, paragraph := range strings.Split(content, "\n\n") {
+			parts = append(parts, sentenceEnd.Split(paragraph, -1)...)
+		}
+		return parts, nil
+	default:
+		return nil, fmt.Errorf("invalid boundary parameter: %q", boundary)
+	}
+}
+
+// TaskSeparator returns the separator at which the content of a map task can
+// be cut, so that the parts map to the same mappings as the whole: a newline,
+// or a blank line if n-grams do not cross the end of a sentence, since a
+// sentence can span lines.
+func TaskSeparator(params url.Values) string {
+	if params.Get("boundary") == "sentence" {
+		return "\n\n"
+	}
+	return "\n"
+}
+
+// ngrams returns the n-grams of the words for n from minN to maxN, as the
+// words joined by a space.
+func ngrams(words []string, minN, maxN int) []string {
+
+	if minN == 1 && maxN == 1 {
+		return words
+	}
+
+	grams := []string{}
+	for n := minN; n <= maxN; n++ {
+		for i := 0; i+n <= len(words); i++ {
+			grams = append(grams, strings.Join(words[i:i+n], " "))
+		}
+	}
+	return grams
+}
@@ -0,0 +1,90 @@
+package job
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ngramRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   string
+		wantMin int
+		wantMax int
+		wantErr string
+	}{
+		{name: "test default", param: "", wantMin: 1, wantMax: 1},
+		{name: "test single n", param: "2", wantMin: 2, wantMax: 2},
+		{name: "test range", param: "1-3", wantMin: 1, wantMax: 3},
+		{name: "test reversed range", param: "3-1", wantErr: `invalid ngrams parameter: "3-1"`},
+		{name: "test zero", param: "0", wantErr: `invalid ngrams parameter: "0"`},
+		{name: "test too long", param: "2-11", wantErr: `invalid ngrams parameter: "2-11"`},
+		{name: "test not a number", param: "two", wantErr: `invalid ngrams parameter: "two"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotMin, gotMax, err := ngramRange(tt.param)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMin, gotMin)
+			assert.Equal(t, tt.wantMax, gotMax)
+		})
+	}
+}
+
+func Test_segments(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		boundary string
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:    "test lines",
+			content: "Lorem ipsum. Dolor\nsit amet",
+			want:    []string{"Lorem ipsum. Dolor", "sit amet"},
+		},
+		{
+			name:     "test sentences",
+			content:  "Lorem ipsum. Dolor\nsit amet!\n\nConsectetur 3.14 elit",
+			boundary: "sentence",
+			want:     []string{"Lorem ipsum", "Dolor\nsit amet", "", "Consectetur 3.14 elit"},
+		},
+		{
+			name:     "test invalid boundary",
+			boundary: "page",
+			wantErr:  `invalid boundary parameter: "page"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := segments(tt.content, tt.boundary)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_TaskSeparator(t *testing.T) {
+	assert.Equal(t, "\n", TaskSeparator(url.Values{}))
+	assert.Equal(t, "\n", TaskSeparator(url.Values{"boundary": {"line"}}))
+	assert.Equal(t, "\n\n", TaskSeparator(url.Values{"boundary": {"sentence"}}))
+}
+
+func Test_ngrams(t *testing.T) {
+	words := []string{"lorem", "ipsum", "dolor"}
+	assert.Equal(t, words, ngrams(words, 1, 1))
+	assert.Equal(t, []string{"lorem ipsum", "ipsum dolor"}, ngrams(words, 2, 2))
+	assert.Equal(t, []string{"lorem", "ipsum", "dolor", "lorem ipsum", "ipsum dolor", "lorem ipsum dolor"}, ngrams(words, 1, 3))
+	assert.Equal(t, []string{}, ngrams(words, 4, 4))
+}
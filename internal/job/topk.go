@@ -0,0 +1,111 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TopK selects the K keys with the highest counts among those that pass its
+// filters. It only applies to jobs whose final values are integer counts.
+//
+// Each reduce worker keeps the top K of its keys and the coordinator merges
+// them: since every key is reduced by a single worker, the global top K is
+// among the local ones.
+type TopK struct {
+	K        int
+	MinCount int
+	Prefix   string
+	Match    *regexp.Regexp
+}
+
+// Ranked is a key with its count, in the result of a top-K query.
+type Ranked struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// ParseTopK reads a top-K query from the parameters:
+//
+//	top        the number of keys to return
+//	min_count  the minimum count of a key
+//	prefix     the prefix of the keys
+//	match      a regular expression the keys must match
+//
+// It returns nil if the top parameter is not given.
+func ParseTopK(params url.Values) (*TopK, error) {
+
+	if !params.Has("top") {
+		return nil, nil
+	}
+
+	t := &TopK{Prefix: params.Get("prefix")}
+
+	var err error
+	if t.K, err = strconv.Atoi(params.Get("top")); err != nil || t.K < 1 {
+		return nil, fmt.Errorf("invalid top parameter: %q", params.Get("top"))
+	}
+	if v := params.Get("min_count"); v != "" {
+		if t.MinCount, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid min_count parameter: %q", v)
+		}
+	}
+	if v := params.Get("match"); v != "" {
+		if t.Match, err = regexp.Compile(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// Rank returns the top K keys of the result that pass the filters, sorted by
+// decreasing count and then by key.
+func (t *TopK) Rank(result map[string]json.RawMessage) ([]Ranked, error) {
+
+	ranked := []Ranked{}
+	for key, value := range result {
+		var count int
+		if err := json.Unmarshal(value, &count); err != nil {
+			return nil, fmt.Errorf("top: value of %q is not a count", key)
+		}
+		if count < t.MinCount || !strings.HasPrefix(key, t.Prefix) {
+			continue
+		}
+		if t.Match != nil && !t.Match.MatchString(key) {
+			continue
+		}
+		ranked = append(ranked, Ranked{key, count})
+	}
+
+	sort.Slice(ranked, func(a, b int) bool {
+		if ranked[a].Count != ranked[b].Count {
+			return ranked[a].Count > ranked[b].Count
+		}
+		return ranked[a].Key < ranked[b].Key
+	})
+	if len(ranked) > t.K {
+		ranked = ranked[:t.K]
+	}
+
+	return ranked, nil
+}
+
+// Select is like Rank, but returns the selected keys as a result.
+func (t *TopK) Select(result map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+
+	ranked, err := t.Rank(result)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]json.RawMessage, len(ranked))
+	for _, r := range ranked {
+		selected[r.Key] = result[r.Key]
+	}
+	return selected, nil
+}
@@ -0,0 +1,99 @@
+package job
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TopK_Rank(t *testing.T) {
+
+	result := map[string]json.RawMessage{
+		"lorem":     json.RawMessage("5"),
+		"ipsum":     json.RawMessage("3"),
+		"dolor":     json.RawMessage("3"),
+		"sit":       json.RawMessage("1"),
+		"lorem sit": json.RawMessage("2"),
+	}
+
+	tests := []struct {
+		name    string
+		params  url.Values
+		result  map[string]json.RawMessage
+		want    []Ranked
+		wantErr string
+	}{
+		{
+			name:   "test top k",
+			params: url.Values{"top": {"3"}},
+			result: result,
+			want:   []Ranked{{"lorem", 5}, {"dolor", 3}, {"ipsum", 3}},
+		},
+		{
+			name:   "test k larger than result",
+			params: url.Values{"top": {"10"}, "min_count": {"2"}},
+			result: result,
+			want:   []Ranked{{"lorem", 5}, {"dolor", 3}, {"ipsum", 3}, {"lorem sit", 2}},
+		},
+		{
+			name:   "test prefix",
+			params: url.Values{"top": {"10"}, "prefix": {"lorem"}},
+			result: result,
+			want:   []Ranked{{"lorem", 5}, {"lorem sit", 2}},
+		},
+		{
+			name:   "test match",
+			params: url.Values{"top": {"10"}, "match": {"^[a-z]+$"}, "min_count": {"3"}},
+			result: result,
+			want:   []Ranked{{"lorem", 5}, {"dolor", 3}, {"ipsum", 3}},
+		},
+		{
+			name:    "test not a count",
+			params:  url.Values{"top": {"1"}},
+			result:  map[string]json.RawMessage{"lorem": json.RawMessage(`["doc1"]`)},
+			wantErr: `top: value of "lorem" is not a count`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			top, err := ParseTopK(tt.params)
+			if !assert.NoError(t, err) {
+				return
+			}
+			got, err := top.Rank(tt.result)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_ParseTopK(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  url.Values
+		wantNil bool
+		wantErr string
+	}{
+		{name: "test no top k", params: url.Values{"prefix": {"lorem"}}, wantNil: true},
+		{name: "test invalid top", params: url.Values{"top": {"0"}}, wantErr: `invalid top parameter: "0"`},
+		{name: "test invalid min count", params: url.Values{"top": {"1"}, "min_count": {"x"}}, wantErr: `invalid min_count parameter: "x"`},
+		{name: "test invalid match", params: url.Values{"top": {"1"}, "match": {"("}}, wantErr: "error parsing regexp: missing closing ): `(`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTopK(tt.params)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantNil, got == nil)
+		})
+	}
+}
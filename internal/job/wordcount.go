@@ -0,0 +1,76 @@
+package job
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"github.com/FDeRubeis/mapreduce/internal/tokenize"
+)
+
+func init() {
+	Register(&Job{
+		Name:    "wordcount",
+		Map:     wordCountMap,
+		Combine: sum,
+		Reduce:  sum,
+		Counts:  true,
+	})
+}
+
+// wordCountMap maps each word of the content to the occurrence "1". The words
+// are split by the tokenizer chosen in the parameters, and the stop words are
+// dropped. With the ngrams parameter it maps the n-grams of the remaining
+// words instead, without crossing the boundaries chosen in the parameters.
+func wordCountMap(content string, params url.Values) ([]kv.KV, error) {
+
+	tokenizer, err := tokenize.FromParams(params)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := tokenize.FilterFromParams(params, tokenizer)
+	if err != nil {
+		return nil, err
+	}
+	minN, maxN, err := ngramRange(params.Get("ngrams"))
+	if err != nil {
+		return nil, err
+	}
+	parts, err := segments(content, params.Get("boundary"))
+	if err != nil {
+		return nil, err
+	}
+
+	// compute word mappings
+	pairs := []kv.KV{}
+	for _, part := range parts {
+
+		words := []string{}
+		for _, word := range tokenizer.Tokens(part) {
+			if filter.Keep(word) {
+				words = append(words, word)
+			}
+		}
+
+		for _, gram := range ngrams(words, minN, maxN) {
+			pairs = append(pairs, kv.KV{Key: gram, Value: one})
+		}
+	}
+
+	return pairs, nil
+}
+
+var one = json.RawMessage("1")
+
+// sum adds up integer values.
+func sum(_ string, values []json.RawMessage) (json.RawMessage, error) {
+	total := 0
+	for _, value := range values {
+		var n int
+		if err := json.Unmarshal(value, &n); err != nil {
+			return nil, err
+		}
+		total += n
+	}
+	return json.Marshal(total)
+}
@@ -0,0 +1,202 @@
+// Package kv defines the key/value records exchanged by the services.
+//
+// Records are encoded as a JSON array of [key, value] pairs. The legacy
+// format, where mappings are single-key JSON objects and groups and results
+// are JSON objects, is still accepted and produced when a client asks for it
+// through content negotiation. It will be removed in the next release.
+package kv
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// content types of the record formats
+const (
+	ContentType       = "application/vnd.mapreduce.kv+json"
+	LegacyContentType = "application/json"
+)
+
+// KV is a key/value record. It is encoded as the JSON array [key, value].
+type KV struct {
+	Key   string
+	Value json.RawMessage
+}
+
+func (r KV) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]any{r.Key, r.Value})
+}
+
+func (r *KV) UnmarshalJSON(data []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("kv: record with %d elements", len(pair))
+	}
+	if err := json.Unmarshal(pair[0], &r.Key); err != nil {
+		return err
+	}
+	r.Value = pair[1]
+	return nil
+}
+
+// Format returns the record format of a Content-Type header. Anything other
+// than ContentType is the legacy format.
+func Format(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && mediaType == ContentType {
+		return ContentType
+	}
+	return LegacyContentType
+}
+
+// Negotiate returns the record format to answer with, given the Accept header
+// of a request. Clients that do not ask for ContentType, or refuse it with a
+// quality of 0, get the legacy format.
+func Negotiate(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != ContentType {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if quality, err := strconv.ParseFloat(q, 64); err != nil || quality <= 0 {
+				continue
+			}
+		}
+		return ContentType
+	}
+	return LegacyContentType
+}
+
+// MarshalPairs encodes a list of records, where keys can repeat, such as the
+// mappings of a map task. In the legacy format, each record is a single-key
+// object.
+func MarshalPairs(pairs []KV, format string) ([]byte, error) {
+	if format == ContentType {
+		return json.Marshal(pairs)
+	}
+
+	mappings := make([]map[string]json.RawMessage, 0, len(pairs))
+	for _, pair := range pairs {
+		mappings = append(mappings, map[string]json.RawMessage{pair.Key: pair.Value})
+	}
+	return json.Marshal(mappings)
+}
+
+// UnmarshalPairs decodes a list of records encoded by MarshalPairs.
+func UnmarshalPairs(data []byte, format string) ([]KV, error) {
+	pairs := []KV{}
+	if format == ContentType {
+		err := json.Unmarshal(data, &pairs)
+		return pairs, err
+	}
+
+	mappings := []map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return nil, err
+	}
+	for _, mapping := range mappings {
+		if len(mapping) != 1 {
+			return nil, fmt.Errorf("kv: mapping with %d keys", len(mapping))
+		}
+		for key, value := range mapping {
+			pairs = append(pairs, KV{key, value})
+		}
+	}
+	return pairs, nil
+}
+
+// MarshalMap encodes records with distinct keys, such as the results of a
+// reduce task. The records are sorted by key. In the legacy format, the
+// records are a single JSON object.
+func MarshalMap(m map[string]json.RawMessage, format string) ([]byte, error) {
+	if format != ContentType {
+		return json.Marshal(m)
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]KV, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, KV{key, m[key]})
+	}
+	return json.Marshal(pairs)
+}
+
+// UnmarshalMap decodes records encoded by MarshalMap.
+func UnmarshalMap(data []byte, format string) (map[string]json.RawMessage, error) {
+	m := map[string]json.RawMessage{}
+	if format != ContentType {
+		err := json.Unmarshal(data, &m)
+		return m, err
+	}
+
+	pairs := []KV{}
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		m[pair.Key] = pair.Value
+	}
+	return m, nil
+}
+
+// Group collects the values of the records by key, as the shuffle phase does.
+func Group(pairs []KV) map[string][]json.RawMessage {
+	groups := map[string][]json.RawMessage{}
+	for _, pair := range pairs {
+		groups[pair.Key] = append(groups[pair.Key], pair.Value)
+	}
+	return groups
+}
+
+// MarshalGroups encodes the values grouped by key in the shuffle phase. Each
+// record holds the JSON array of the values of its key.
+func MarshalGroups(groups map[string][]json.RawMessage, format string) ([]byte, error) {
+	if format != ContentType {
+		return json.Marshal(groups)
+	}
+
+	m := make(map[string]json.RawMessage, len(groups))
+	for key, values := range groups {
+		encoded, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = encoded
+	}
+	return MarshalMap(m, format)
+}
+
+// UnmarshalGroups decodes groups encoded by MarshalGroups.
+func UnmarshalGroups(data []byte, format string) (map[string][]json.RawMessage, error) {
+	groups := map[string][]json.RawMessage{}
+	if format != ContentType {
+		err := json.Unmarshal(data, &groups)
+		return groups, err
+	}
+
+	m, err := UnmarshalMap(data, format)
+	if err != nil {
+		return nil, err
+	}
+	for key, encoded := range m {
+		values := []json.RawMessage{}
+		if err := json.Unmarshal(encoded, &values); err != nil {
+			return nil, err
+		}
+		groups[key] = values
+	}
+	return groups, nil
+}
@@ -0,0 +1,169 @@
+package kv
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var one = json.RawMessage("1")
+
+func Test_Negotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{
+			name:   "test no accept header",
+			accept: "",
+			want:   LegacyContentType,
+		},
+		{
+			name:   "test kv format",
+			accept: ContentType,
+			want:   ContentType,
+		},
+		{
+			name:   "test kv format among others",
+			accept: "application/json;q=0.5, " + ContentType + ";q=1",
+			want:   ContentType,
+		},
+		{
+			name:   "test kv format refused",
+			accept: ContentType + ";q=0, application/json",
+			want:   LegacyContentType,
+		},
+		{
+			name:   "test kv format with invalid quality",
+			accept: ContentType + ";q=high",
+			want:   LegacyContentType,
+		},
+		{
+			name:   "test any format",
+			accept: "*/*",
+			want:   LegacyContentType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(tt.accept); got != tt.want {
+				t.Errorf("Negotiate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Pairs(t *testing.T) {
+	pairs := []KV{
+		{"lorem", one},
+		{"ipsum", one},
+		{"lorem", one},
+	}
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{
+			name:   "test kv format",
+			format: ContentType,
+			want:   `[["lorem",1],["ipsum",1],["lorem",1]]`,
+		},
+		{
+			name:   "test legacy format",
+			format: LegacyContentType,
+			want:   `[{"lorem":1},{"ipsum":1},{"lorem":1}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MarshalPairs(pairs, tt.format)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+
+			got, err := UnmarshalPairs(data, tt.format)
+			assert.NoError(t, err)
+			if !reflect.DeepEqual(got, pairs) {
+				t.Errorf("UnmarshalPairs() = %s, want %s", got, pairs)
+			}
+		})
+	}
+}
+
+func Test_Groups(t *testing.T) {
+	groups := map[string][]json.RawMessage{
+		"lorem": {one, json.RawMessage("2")},
+		"ipsum": {one},
+	}
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{
+			name:   "test kv format",
+			format: ContentType,
+			want:   `[["ipsum",[1]],["lorem",[1,2]]]`,
+		},
+		{
+			name:   "test legacy format",
+			format: LegacyContentType,
+			want:   `{"ipsum":[1],"lorem":[1,2]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MarshalGroups(groups, tt.format)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+
+			got, err := UnmarshalGroups(data, tt.format)
+			assert.NoError(t, err)
+			if !reflect.DeepEqual(got, groups) {
+				t.Errorf("UnmarshalGroups() = %s, want %s", got, groups)
+			}
+		})
+	}
+}
+
+func Test_Group(t *testing.T) {
+	pairs := []KV{{"lorem", one}, {"ipsum", one}, {"lorem", json.RawMessage("2")}}
+	want := map[string][]json.RawMessage{
+		"lorem": {one, json.RawMessage("2")},
+		"ipsum": {one},
+	}
+	if got := Group(pairs); !reflect.DeepEqual(got, want) {
+		t.Errorf("Group() = %s, want %s", got, want)
+	}
+}
+
+func Test_UnmarshalPairs_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		format  string
+		wantErr string
+	}{
+		{
+			name:    "test record with three elements",
+			data:    `[["lorem",1,2]]`,
+			format:  ContentType,
+			wantErr: "kv: record with 3 elements",
+		},
+		{
+			name:    "test mapping with two keys",
+			data:    `[{"lorem":1,"ipsum":1}]`,
+			format:  LegacyContentType,
+			wantErr: "kv: mapping with 2 keys",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := UnmarshalPairs([]byte(tt.data), tt.format)
+			assert.EqualErrorf(t, err, tt.wantErr, "UnmarshalPairs() = %v, want %q", err, tt.wantErr)
+		})
+	}
+}
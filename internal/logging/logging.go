@@ -0,0 +1,210 @@
+// Package logging configures the logs of the services and carries the fields
+// that join them across the services: the job, the task, its phase and the
+// worker that ran it.
+//
+// The coordinator sends the job and the task to the workers in the headers
+// of the HTTP requests, or in the metadata of the gRPC calls. The workers
+// log with the fields of the request, taken from its context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// headers of the task requests. gRPC metadata uses them in lower case.
+const (
+	JobIDHeader   = "X-Job-Id"
+	TaskIDHeader  = "X-Task-Id"
+	AttemptHeader = "X-Task-Attempt"
+)
+
+// WorkerHeader is the header of the answers to the task requests, or the
+// header metadata of the gRPC calls, that names the worker that served the
+// task.
+const WorkerHeader = "X-Worker"
+
+// worker is the name of this worker: its host name, which in Kubernetes is
+// the name of its pod.
+var worker, _ = os.Hostname()
+
+// fields of the log entries
+const (
+	JobField     = "job_id"
+	TaskField    = "task_id"
+	AttemptField = "attempt"
+	PhaseField   = "phase"
+	WorkerField  = "worker"
+)
+
+// snippetLength is the length of the document snippets in the logs.
+const snippetLength = 16
+
+// snippets is whether the logs may quote the documents.
+var snippets bool
+
+// formats of the logs
+const (
+	JSON = "json"
+	Text = "text"
+)
+
+// Config is the configuration of the logs of a service.
+type Config struct {
+	// Format is JSON or Text.
+	Format string
+	Level  log.Level
+	// Snippets is whether the logs may quote the documents, which may hold
+	// private data.
+	Snippets bool
+}
+
+// Register registers the settings of the logs: log-format, log-level and
+// log-snippets.
+func (c *Config) Register(s *config.Set) {
+	s.EnumVar(&c.Format, "log-format", JSON, []string{JSON, Text}, "format of the logs")
+	s.TextVar(&c.Level, "log-level", log.InfoLevel, "minimum level of the logs, such as debug or warning")
+	s.BoolVar(&c.Snippets, "log-snippets", false, "quote the beginning of the documents in the logs")
+}
+
+// Setup configures the standard logger.
+func Setup(c Config) {
+	if c.Format == Text {
+		log.SetFormatter(&log.TextFormatter{})
+	} else {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+	log.SetLevel(c.Level)
+	snippets = c.Snippets
+}
+
+// TaskID returns the ID of a task in the logs: its phase and its index, as
+// in "map-3". The ID is the same for all the attempts of the task.
+func TaskID(phase string, index int) string {
+	return fmt.Sprintf("%s-%d", phase, index)
+}
+
+// Snippet adds the beginning of a document to the entry, if the documents
+// may be logged. The document is only formatted then, so that a payload is
+// not formatted for nothing.
+func Snippet(entry *log.Entry, document func() string) *log.Entry {
+	if !snippets {
+		return entry
+	}
+	return entry.WithField("snippet", fmt.Sprintf("%.*s", snippetLength, document()))
+}
+
+type entryKey struct{}
+
+// WithEntry returns a context that carries the entry.
+func WithEntry(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, entry)
+}
+
+// FromContext returns the entry carried by ctx, or an entry of the standard
+// logger without fields.
+func FromContext(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(entryKey{}).(*log.Entry); ok {
+		return entry
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// WithFields returns a context whose entry has the fields added.
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	return WithEntry(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// SetHeaders adds the job and the task to the headers of a task request.
+func SetHeaders(header http.Header, jobID, taskID string, attempt int) {
+	if jobID != "" {
+		header.Set(JobIDHeader, jobID)
+	}
+	header.Set(TaskIDHeader, taskID)
+	header.Set(AttemptHeader, strconv.Itoa(attempt))
+}
+
+// OutgoingGRPC adds the job and the task to the metadata of the gRPC calls
+// made with the returned context.
+func OutgoingGRPC(ctx context.Context, jobID, taskID string, attempt int) context.Context {
+	md := metadata.Pairs(TaskIDHeader, taskID, AttemptHeader, strconv.Itoa(attempt))
+	if jobID != "" {
+		md.Set(JobIDHeader, jobID)
+	}
+	out, _ := metadata.FromOutgoingContext(ctx)
+	return metadata.NewOutgoingContext(ctx, metadata.Join(out, md))
+}
+
+// Handler logs the task requests to h, served by a worker of the phase, with
+// the fields of their headers. The answers name the worker.
+func Handler(phase string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(WorkerHeader, worker)
+		fields := taskFields(phase, r.Header.Get)
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			fields[WorkerField] = addr.String()
+		}
+		h.ServeHTTP(w, r.WithContext(WithFields(r.Context(), fields)))
+	})
+}
+
+// StreamInterceptor logs the gRPC task calls served by a worker of the
+// phase with the fields of their metadata. The header metadata of the calls
+// names the worker.
+func StreamInterceptor(phase string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+		if err := ss.SetHeader(metadata.Pairs(WorkerHeader, worker)); err != nil {
+			return err
+		}
+
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		fields := taskFields(phase, func(key string) string {
+			if values := md.Get(key); len(values) > 0 {
+				return values[0]
+			}
+			return ""
+		})
+		if p, ok := peer.FromContext(ss.Context()); ok && p.LocalAddr != nil {
+			fields[WorkerField] = p.LocalAddr.String()
+		}
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: WithFields(ss.Context(), fields)})
+	}
+}
+
+// taskFields returns the fields of a task request, whose headers are read
+// with get.
+func taskFields(phase string, get func(key string) string) log.Fields {
+	fields := log.Fields{PhaseField: phase}
+	if v := get(JobIDHeader); v != "" {
+		fields[JobField] = v
+	}
+	if v := get(TaskIDHeader); v != "" {
+		fields[TaskField] = v
+	}
+	if v, err := strconv.Atoi(get(AttemptHeader)); err == nil {
+		fields[AttemptField] = v
+	}
+	return fields
+}
+
+// serverStream is a server stream with the context of its log entry.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
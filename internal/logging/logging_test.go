@@ -0,0 +1,163 @@
+package logging
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func Test_Config(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    Config
+		wantErr string
+	}{
+		{
+			name: "test defaults",
+			want: Config{Format: JSON, Level: log.InfoLevel},
+		},
+		{
+			name: "test configured logs",
+			env:  map[string]string{"LOG_FORMAT": "text", "LOG_LEVEL": "debug", "LOG_SNIPPETS": "true"},
+			want: Config{Format: Text, Level: log.DebugLevel, Snippets: true},
+		},
+		{
+			name:    "test invalid format",
+			env:     map[string]string{"LOG_FORMAT": "xml"},
+			wantErr: "invalid LOG_FORMAT: xml: must be one of json, text",
+		},
+		{
+			name:    "test invalid level",
+			env:     map[string]string{"LOG_LEVEL": "loud"},
+			wantErr: `invalid LOG_LEVEL: loud: not a valid logrus Level: "loud"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"LOG_FORMAT", "LOG_LEVEL", "LOG_SNIPPETS"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			var got Config
+			settings := config.New("test")
+			got.Register(settings)
+			err := settings.Load(nil)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_Setup(t *testing.T) {
+	logger := log.StandardLogger()
+	formatter, level := logger.Formatter, logger.GetLevel()
+	defer func() {
+		log.SetFormatter(formatter)
+		log.SetLevel(level)
+		snippets = false
+	}()
+
+	Setup(Config{Format: Text, Level: log.WarnLevel, Snippets: true})
+	assert.IsType(t, &log.TextFormatter{}, logger.Formatter)
+	assert.Equal(t, log.WarnLevel, logger.GetLevel())
+	assert.True(t, snippets)
+
+	Setup(Config{Format: JSON, Level: log.InfoLevel})
+	assert.IsType(t, &log.JSONFormatter{}, logger.Formatter)
+	assert.False(t, snippets)
+}
+
+func Test_Snippet(t *testing.T) {
+	entry := log.NewEntry(log.StandardLogger())
+	defer func() { snippets = false }()
+
+	formatted := 0
+	document := func() string {
+		formatted++
+		return "lorem ipsum dolor sit amet"
+	}
+
+	assert.NotContains(t, Snippet(entry, document).Data, "snippet")
+	assert.Equal(t, 0, formatted)
+
+	snippets = true
+	assert.Equal(t, "lorem ipsum dolo", Snippet(entry, document).Data["snippet"])
+	assert.Equal(t, 1, formatted)
+}
+
+func Test_Handler(t *testing.T) {
+
+	var got log.Fields
+	h := Handler("map", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context()).Data
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	SetHeaders(r.Header, "c0ffee", TaskID("map", 3), 1)
+	r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 80}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, worker, w.Header().Get(WorkerHeader))
+	assert.Equal(t, log.Fields{
+		JobField:     "c0ffee",
+		TaskField:    "map-3",
+		AttemptField: 1,
+		PhaseField:   "map",
+		WorkerField:  "10.0.0.7:80",
+	}, got)
+}
+
+func Test_StreamInterceptor(t *testing.T) {
+
+	// the outgoing metadata of the client is the incoming metadata of the
+	// server
+	md, _ := metadata.FromOutgoingContext(OutgoingGRPC(context.Background(), "", TaskID("reduce", 0), 2))
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	ctx = peer.NewContext(ctx, &peer.Peer{LocalAddr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 9090}})
+
+	var got log.Fields
+	stream := &fakeStream{ctx: ctx}
+	err := StreamInterceptor("reduce")(nil, stream, &grpc.StreamServerInfo{}, func(srv any, ss grpc.ServerStream) error {
+		got = FromContext(ss.Context()).Data
+		return nil
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{worker}, stream.header.Get(WorkerHeader))
+	assert.Equal(t, log.Fields{
+		TaskField:    "reduce-0",
+		AttemptField: 2,
+		PhaseField:   "reduce",
+		WorkerField:  "10.0.0.9:9090",
+	}, got)
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *fakeStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
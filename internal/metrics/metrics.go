@@ -0,0 +1,147 @@
+// Package metrics defines the Prometheus metrics of the services.
+//
+// The coordinator records the jobs, phases and tasks it runs and the latency
+// of every worker it calls. The workers record the requests they serve, over
+// HTTP and gRPC. All the metrics are registered in the default registry,
+// served by Handler.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "mapreduce"
+
+// outcomes of jobs, phases, tasks and requests
+const (
+	Succeeded = "succeeded"
+	Failed    = "failed"
+	TimedOut  = "timed_out"
+	Canceled  = "canceled"
+)
+
+// sizeBuckets count mappings, keys and values, from 1 to about 1M.
+var sizeBuckets = prometheus.ExponentialBuckets(1, 4, 11)
+
+// coordinator metrics
+var (
+	Jobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_total",
+		Help:      "Jobs run, by job and outcome.",
+	}, []string{"job", "status"})
+
+	JobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of the jobs, by job.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"job"})
+
+	PhaseDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "phase_duration_seconds",
+		Help:      "Duration of the phases of the jobs, by phase and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"phase", "status"})
+
+	Tasks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_total",
+		Help:      "Tasks sent to the workers, by phase and outcome after the retries.",
+	}, []string{"phase", "status"})
+
+	TaskAttemptFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "task_attempt_failures_total",
+		Help:      "Failed attempts of the tasks, retried or not, by phase.",
+	}, []string{"phase"})
+
+	WorkerRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "worker_request_duration_seconds",
+		Help:      "Latency of the task requests to the workers, by phase, worker name and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"phase", "worker", "status"})
+
+	Mappings = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mappings_total",
+		Help:      "Key-value pairs produced by the map phases.",
+	})
+
+	DistinctKeys = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_distinct_keys",
+		Help:      "Distinct keys of the jobs, after the shuffle phase.",
+		Buckets:   sizeBuckets,
+	})
+
+	ShufflePartitionSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "shuffle_partition_mappings",
+		Help:      "Mappings assigned to each shuffle task.",
+		Buckets:   sizeBuckets,
+	})
+
+	HotKeys = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hot_keys_total",
+		Help:      "Keys spread among several shuffle tasks for their share of the mappings of a job.",
+	})
+
+	ReduceSkew = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reduce_skew_ratio",
+		Help:      "Values of the largest reduce task of a job over the mean values of its reduce tasks; 1 is a perfect balance.",
+		Buckets:   []float64{1, 1.1, 1.25, 1.5, 2, 3, 5, 10, 25},
+	})
+)
+
+// worker metrics
+var (
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the task requests served, by service, transport and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "transport", "status"})
+
+	BytesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "received_bytes_total",
+		Help:      "Bytes of the task requests served, by service and transport.",
+	}, []string{"service", "transport"})
+
+	BytesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sent_bytes_total",
+		Help:      "Bytes of the task responses, by service and transport.",
+	}, []string{"service", "transport"})
+)
+
+// Status returns the outcome of a job, phase, task or request that ended
+// with err.
+func Status(err error) string {
+	switch {
+	case err == nil:
+		return Succeeded
+	case errors.Is(err, context.DeadlineExceeded):
+		return TimedOut
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	default:
+		return Failed
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
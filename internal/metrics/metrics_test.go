@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/stats"
+)
+
+func Test_Status(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "test success", want: Succeeded},
+		{name: "test failure", err: errors.New("worker answered 500"), want: Failed},
+		{name: "test timeout", err: fmt.Errorf("job timed out: %w", context.DeadlineExceeded), want: TimedOut},
+		{name: "test cancellation", err: fmt.Errorf("map task 0 failed: %w", context.Canceled), want: Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Status(tt.err))
+		})
+	}
+}
+
+func Test_Instrument(t *testing.T) {
+	tests := []struct {
+		name       string
+		service    string
+		body       string
+		status     int
+		wantStatus string
+	}{
+		{
+			name:       "test successful request",
+			service:    "test-ok",
+			body:       "lorem ipsum",
+			status:     http.StatusOK,
+			wantStatus: Succeeded,
+		},
+		{
+			name:       "test failed request",
+			service:    "test-failed",
+			body:       "gibberish",
+			status:     http.StatusBadRequest,
+			wantStatus: Failed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Instrument(tt.service, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+				w.Write([]byte("answer"))
+			}))
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+
+			assert.Equal(t, float64(len(tt.body)), testutil.ToFloat64(BytesReceived.WithLabelValues(tt.service, httpTransport)))
+			assert.Equal(t, float64(len("answer")), testutil.ToFloat64(BytesSent.WithLabelValues(tt.service, httpTransport)))
+			assert.Equal(t, uint64(1), sampleCount(t, RequestDuration.WithLabelValues(tt.service, httpTransport, tt.wantStatus)))
+		})
+	}
+}
+
+func Test_GRPCStats(t *testing.T) {
+	s := GRPCStats{Service: "test-grpc"}
+	ctx := context.Background()
+
+	begin := time.Now()
+	s.HandleRPC(ctx, &stats.InPayload{WireLength: 12})
+	s.HandleRPC(ctx, &stats.OutPayload{WireLength: 30})
+	s.HandleRPC(ctx, &stats.End{BeginTime: begin, EndTime: begin.Add(time.Second)})
+
+	assert.Equal(t, 12.0, testutil.ToFloat64(BytesReceived.WithLabelValues("test-grpc", grpcTransport)))
+	assert.Equal(t, 30.0, testutil.ToFloat64(BytesSent.WithLabelValues("test-grpc", grpcTransport)))
+	assert.Equal(t, uint64(1), sampleCount(t, RequestDuration.WithLabelValues("test-grpc", grpcTransport, Succeeded)))
+}
+
+// sampleCount returns the number of observations of a histogram.
+func sampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	if err := o.(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
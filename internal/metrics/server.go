@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/stats"
+)
+
+// transports of the task requests
+const (
+	httpTransport = "http"
+	grpcTransport = "grpc"
+)
+
+// Instrument records the latency and the bytes of the task requests served
+// by h, for the service.
+func Instrument(service string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		h.ServeHTTP(rec, r)
+
+		status := Succeeded
+		if rec.status >= 400 {
+			status = Failed
+		}
+		RequestDuration.WithLabelValues(service, httpTransport, status).Observe(time.Since(start).Seconds())
+		BytesReceived.WithLabelValues(service, httpTransport).Add(float64(body.n))
+		BytesSent.WithLabelValues(service, httpTransport).Add(float64(rec.n))
+	})
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += n
+	return n, err
+}
+
+// statusRecorder records the status code and counts the bytes of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	n      int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += n
+	return n, err
+}
+
+// GRPCStats records the latency and the bytes of the task calls served over
+// gRPC, for the service. It is installed with grpc.StatsHandler.
+type GRPCStats struct {
+	Service string
+}
+
+func (s GRPCStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (s GRPCStats) HandleRPC(_ context.Context, rs stats.RPCStats) {
+	switch rs := rs.(type) {
+	case *stats.InPayload:
+		BytesReceived.WithLabelValues(s.Service, grpcTransport).Add(float64(rs.WireLength))
+	case *stats.OutPayload:
+		BytesSent.WithLabelValues(s.Service, grpcTransport).Add(float64(rs.WireLength))
+	case *stats.End:
+		RequestDuration.WithLabelValues(s.Service, grpcTransport, Status(rs.Error)).Observe(rs.EndTime.Sub(rs.BeginTime).Seconds())
+	}
+}
+
+func (s GRPCStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s GRPCStats) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,169 @@
+// Package output writes the final values of a job as JSON, CSV, TSV or NDJSON,
+// sorted by key or by count.
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/FDeRubeis/mapreduce/internal/job"
+)
+
+// formats of the output, by media type
+const (
+	JSON   = "application/json"
+	CSV    = "text/csv"
+	TSV    = "text/tab-separated-values"
+	NDJSON = "application/x-ndjson"
+)
+
+// orders of the output
+const (
+	ByKey   = "key"
+	ByCount = "count"
+)
+
+// Row is a key of the result with its final value.
+type Row struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Sort returns the keys of the result sorted by key, or by decreasing count
+// and then by key.
+func Sort(result map[string]json.RawMessage, order string) ([]Row, error) {
+
+	rows := make([]Row, 0, len(result))
+	counts := make(map[string]int, len(result))
+	for key, value := range result {
+		rows = append(rows, Row{key, value})
+		if order == ByCount {
+			var count int
+			if err := json.Unmarshal(value, &count); err != nil {
+				return nil, fmt.Errorf("value of %q is not a count", key)
+			}
+			counts[key] = count
+		}
+	}
+
+	sort.Slice(rows, func(a, b int) bool {
+		if order == ByCount && counts[rows[a].Key] != counts[rows[b].Key] {
+			return counts[rows[a].Key] > counts[rows[b].Key]
+		}
+		return rows[a].Key < rows[b].Key
+	})
+
+	return rows, nil
+}
+
+// Search returns the position of the row in rows sorted by Sort in the given
+// order, and whether it is one of them. It takes the value of the row, since
+// the rows sorted by count are searched by count and then by key.
+func Search(rows []Row, order string, row Row) (int, bool) {
+
+	var count int
+	if order == ByCount {
+		if err := json.Unmarshal(row.Value, &count); err != nil {
+			return 0, false
+		}
+	}
+
+	i := sort.Search(len(rows), func(i int) bool {
+		if order == ByCount {
+			// the values of rows sorted by count are counts
+			var c int
+			json.Unmarshal(rows[i].Value, &c)
+			if c != count {
+				return c < count
+			}
+		}
+		return rows[i].Key >= row.Key
+	})
+
+	return i, i < len(rows) && rows[i].Key == row.Key
+}
+
+// tsvEscaper escapes the characters that cannot appear in a TSV field.
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// Encode writes the rows in the given format. CSV and TSV start with a header
+// line and NDJSON has one object per row. JSON is an object whose members are
+// in the order of the rows or, if ranked is true, an array of job.Ranked.
+func Encode(w io.Writer, format string, rows []Row, ranked bool) error {
+
+	switch format {
+	case CSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"key", "value"}); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := cw.Write([]string{row.Key, string(row.Value)}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case TSV:
+		if _, err := io.WriteString(w, "key\tvalue\n"); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if _, err := fmt.Fprintf(w, "%s\t%s\n", tsvEscaper.Replace(row.Key), tsvEscaper.Replace(string(row.Value))); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case NDJSON:
+		enc := json.NewEncoder(w)
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if ranked {
+		ranks := make([]job.Ranked, 0, len(rows))
+		for _, row := range rows {
+			var count int
+			if err := json.Unmarshal(row.Value, &count); err != nil {
+				return err
+			}
+			ranks = append(ranks, job.Ranked{Key: row.Key, Count: count})
+		}
+		ranks_marshaled, err := json.Marshal(ranks)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(ranks_marshaled)
+		return err
+	}
+
+	// write the object members in the order of the rows
+	if _, err := io.WriteString(w, "{"); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		key, err := json.Marshal(row.Key)
+		if err != nil {
+			return err
+		}
+		sep := ","
+		if i == 0 {
+			sep = ""
+		}
+		if _, err := fmt.Fprintf(w, "%s%s:%s", sep, key, row.Value); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "}")
+	return err
+}
@@ -0,0 +1,116 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sort(t *testing.T) {
+
+	result := map[string]json.RawMessage{
+		"lorem": json.RawMessage("3"),
+		"ipsum": json.RawMessage("2"),
+		"dolor": json.RawMessage("2"),
+	}
+
+	tests := []struct {
+		name    string
+		result  map[string]json.RawMessage
+		order   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "test by key", result: result, order: ByKey, want: []string{"dolor", "ipsum", "lorem"}},
+		{name: "test by count", result: result, order: ByCount, want: []string{"lorem", "dolor", "ipsum"}},
+		{name: "test by key of other values", result: map[string]json.RawMessage{"lorem": json.RawMessage(`["a.txt"]`)}, order: ByKey, want: []string{"lorem"}},
+		{name: "test by count of other values", result: map[string]json.RawMessage{"lorem": json.RawMessage(`["a.txt"]`)}, order: ByCount, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := Sort(tt.result, tt.order)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			keys := []string{}
+			for _, row := range rows {
+				keys = append(keys, row.Key)
+			}
+			assert.Equal(t, tt.want, keys)
+		})
+	}
+}
+
+func Test_Search(t *testing.T) {
+
+	result := map[string]json.RawMessage{
+		"lorem": json.RawMessage("3"),
+		"ipsum": json.RawMessage("2"),
+		"dolor": json.RawMessage("2"),
+		"sit":   json.RawMessage("1"),
+	}
+
+	tests := []struct {
+		name      string
+		order     string
+		row       Row
+		want      int
+		wantFound bool
+	}{
+		{name: "test by key", order: ByKey, row: Row{"lorem", result["lorem"]}, want: 2, wantFound: true},
+		{name: "test by count", order: ByCount, row: Row{"ipsum", result["ipsum"]}, want: 2, wantFound: true},
+		{name: "test by count of first key", order: ByCount, row: Row{"lorem", result["lorem"]}, want: 0, wantFound: true},
+		{name: "test by count of last key", order: ByCount, row: Row{"sit", result["sit"]}, want: 3, wantFound: true},
+		{name: "test missing key", order: ByKey, row: Row{"amet", json.RawMessage("1")}, want: 0},
+		{name: "test by count of other value", order: ByCount, row: Row{"ipsum", json.RawMessage("5")}, want: 0},
+		{name: "test by count of value that is not a count", order: ByCount, row: Row{"ipsum", json.RawMessage(`"2"`)}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := Sort(result, tt.order)
+			if !assert.NoError(t, err) {
+				return
+			}
+			got, found := Search(rows, tt.order, tt.row)
+			assert.Equal(t, tt.wantFound, found)
+			if found {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_Encode(t *testing.T) {
+
+	rows := []Row{
+		{Key: "lorem", Value: json.RawMessage("3")},
+		{Key: "dolor\tsit", Value: json.RawMessage("2")},
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		ranked bool
+		want   string
+	}{
+		{name: "test json", format: JSON, want: `{"lorem":3,"dolor\tsit":2}`},
+		{name: "test ranked json", format: JSON, ranked: true, want: `[{"key":"lorem","count":3},{"key":"dolor\tsit","count":2}]`},
+		{name: "test csv", format: CSV, want: "key,value\nlorem,3\ndolor\tsit,2\n"},
+		{name: "test tsv", format: TSV, want: "key\tvalue\nlorem\t3\ndolor\\tsit\t2\n"},
+		{name: "test ndjson", format: NDJSON, want: "{\"key\":\"lorem\",\"value\":3}\n{\"key\":\"dolor\\tsit\",\"value\":2}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			if assert.NoError(t, Encode(w, tt.format, rows, tt.ranked)) {
+				assert.Equal(t, tt.want, w.String())
+			}
+		})
+	}
+}
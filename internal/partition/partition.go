@@ -0,0 +1,305 @@
+// Package partition splits the work of a job in tasks: the document in map
+// tasks, the keys among the shufflers and the groups in reduce tasks.
+package partition
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Lines splits the content in n parts with the same number of lines, where
+// the lines are separated by sep, such as a newline or a blank line. The
+// newline between two parts is dropped, as by Splitter.
+func Lines(content string, n int, sep string) []string {
+
+	// Compute size (in lines) of each partition
+	lines := strings.Split(content, sep)
+	totalLines := len(lines)
+	partSize := totalLines / n
+	remainder := totalLines % n
+
+	parts := make([]string, n)
+	index := 0
+
+	for i := 0; i < n; i++ {
+
+		// Compute size of current partition
+		currentPartSize := partSize
+		if i < remainder {
+			currentPartSize++
+		}
+
+		// Assign lines to partition, with the rest of the separator
+		// before them
+		part := strings.Join(lines[index:index+currentPartSize], sep)
+		if index > 0 && currentPartSize > 0 {
+			part = sep[1:] + part
+		}
+		parts[i] = part
+
+		index += currentPartSize
+	}
+
+	return parts
+}
+
+// Key returns the partition, out of n, of the key. It is the FNV-1a hash of
+// the key modulo n.
+func Key(key string, n int) int {
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32()) % n
+}
+
+// Rendezvous assigns keys to named nodes by rendezvous hashing: a key goes to
+// the node with the highest score for the pair. When a node is added or
+// removed, only the keys it gains or loses move, unlike with Key, where
+// almost all the keys move when n changes.
+type Rendezvous struct {
+	seeds []uint64
+}
+
+// NewRendezvous returns a Rendezvous over the nodes. The nodes are named by a
+// stable identity, such as the name of a pod, so that a key keeps its node
+// across lookups.
+func NewRendezvous(nodes []string) *Rendezvous {
+	seeds := make([]uint64, len(nodes))
+	for i, node := range nodes {
+		seeds[i] = hash64(node)
+	}
+	return &Rendezvous{seeds: seeds}
+}
+
+// Node returns the index of the node of the key.
+func (r *Rendezvous) Node(key string) int {
+
+	h := hash64(key)
+	best, bestScore := 0, uint64(0)
+	for i, seed := range r.seeds {
+		if score := mix(h ^ seed); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// hash64 returns the FNV-1a hash of s.
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// mix spreads the bits of x, so that the scores of the nodes of a key are
+// independent of each other. It is the finalizer of SplitMix64.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Groups splits the groups of values by key in n parts, for the reduce tasks.
+// The parts are balanced by their number of values rather than of keys: the
+// largest groups are assigned first, each to the part with the fewest values
+// so far.
+func Groups(shuffle map[string][]json.RawMessage, n int) []map[string][]json.RawMessage {
+
+	// split shuffle in n parts
+	parts := make([]map[string][]json.RawMessage, n)
+	for i := range parts {
+		parts[i] = map[string][]json.RawMessage{}
+	}
+
+	// largest groups first, by key for equal sizes
+	keys := make([]string, 0, len(shuffle))
+	for key := range shuffle {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(shuffle[keys[i]]) != len(shuffle[keys[j]]) {
+			return len(shuffle[keys[i]]) > len(shuffle[keys[j]])
+		}
+		return keys[i] < keys[j]
+	})
+
+	loads := make(loadHeap, n)
+	for i := range loads {
+		loads[i] = load{part: i}
+	}
+	for _, key := range keys {
+		parts[loads[0].part][key] = shuffle[key]
+		loads[0].values += len(shuffle[key])
+		heap.Fix(&loads, 0)
+	}
+
+	return parts
+}
+
+// load is the number of values assigned to a part.
+type load struct {
+	part   int
+	values int
+}
+
+// loadHeap is a min-heap of the loads of the parts, the least loaded first,
+// then the first part.
+type loadHeap []load
+
+func (h loadHeap) Len() int { return len(h) }
+func (h loadHeap) Less(i, j int) bool {
+	if h[i].values != h[j].values {
+		return h[i].values < h[j].values
+	}
+	return h[i].part < h[j].part
+}
+func (h loadHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *loadHeap) Push(x any)   { *h = append(*h, x.(load)) }
+func (h *loadHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// minHotSamples is the number of samples of a key below which it is never
+// hot, since its estimated share is not reliable.
+const minHotSamples = 16
+
+// Sampler estimates the frequencies of the keys of a job from a sample of its
+// mappings. Each mapping is counted with a probability of 1 in rate, rather
+// than every rate-th one, which would miss keys that recur with the same
+// period in the output of the map tasks. The sample is the same for the same
+// mappings.
+type Sampler struct {
+	rate   int
+	rand   *rand.Rand
+	counts map[string]int
+	total  int
+}
+
+// NewSampler returns a Sampler that counts 1 mapping in rate.
+func NewSampler(rate int) *Sampler {
+	return &Sampler{rate: max(rate, 1), rand: rand.New(rand.NewPCG(0, 0)), counts: map[string]int{}}
+}
+
+// Add adds the key of a mapping to the sample, if it is sampled.
+func (s *Sampler) Add(key string) {
+	if s.rate > 1 && s.rand.IntN(s.rate) != 0 {
+		return
+	}
+	s.counts[key]++
+	s.total++
+}
+
+// Hot returns the keys whose estimated share of the mappings is over share,
+// with that share.
+func (s *Sampler) Hot(share float64) map[string]float64 {
+	hot := map[string]float64{}
+	for key, count := range s.counts {
+		if count < minHotSamples {
+			continue
+		}
+		if keyShare := float64(count) / float64(s.total); keyShare > share {
+			hot[key] = keyShare
+		}
+	}
+	return hot
+}
+
+// Splitter cuts a document read from a stream into map tasks of at most
+// size bytes, so that only the current task is held in memory. A task ends at
+// the last separator that fits, such as a newline or a blank line, else at
+// the last line boundary, or at the last space if a line does not fit, so
+// that words and UTF-8 runes are never cut in half. The newline between two
+// tasks is dropped.
+type Splitter struct {
+	r    io.Reader
+	size int
+	sep  []byte
+	buf  []byte // read but not yet returned
+	err  error  // error of the last read
+}
+
+// NewSplitter returns a Splitter that cuts r in tasks of at most size bytes,
+// preferably at sep, which starts with a newline.
+func NewSplitter(r io.Reader, size int, sep string) *Splitter {
+	return &Splitter{r: r, size: size, sep: []byte(sep)}
+}
+
+// fill reads until buf holds at least n bytes or the stream is over.
+func (s *Splitter) fill(n int) {
+	chunk := make([]byte, 32*1024)
+	for len(s.buf) < n && s.err == nil {
+		var read int
+		read, s.err = s.r.Read(chunk[:min(len(chunk), n-len(s.buf))])
+		s.buf = append(s.buf, chunk[:read]...)
+	}
+}
+
+// take returns the first n bytes of buf as a task and drops them, together
+// with skip more bytes, from buf.
+func (s *Splitter) take(n, skip int) string {
+	task := string(s.buf[:n])
+	s.buf = s.buf[n+skip:]
+	return task
+}
+
+// Next returns the next task, or io.EOF when the document is over.
+func (s *Splitter) Next() (string, error) {
+
+	// look past the size, for a separator right after a full task
+	s.fill(s.size + len(s.sep))
+	if s.err != nil && s.err != io.EOF {
+		return "", s.err
+	}
+	if len(s.buf) == 0 {
+		return "", io.EOF
+	}
+	if len(s.buf) <= s.size && s.err == io.EOF {
+		return s.take(len(s.buf), 0), nil
+	}
+
+	// end at the last separator that fits, else at the last line
+	if i := bytes.LastIndex(s.buf[:min(s.size+len(s.sep), len(s.buf))], s.sep); i > 0 {
+		return s.take(i, 1), nil
+	}
+	if i := bytes.LastIndexByte(s.buf[:s.size+1], '\n'); i > 0 {
+		return s.take(i, 1), nil
+	}
+
+	// end after the last space that fits
+	if i := bytes.LastIndexFunc(s.buf[:s.size], unicode.IsSpace); i >= 0 {
+		_, width := utf8.DecodeRune(s.buf[i:])
+		return s.take(i+width, 0), nil
+	}
+
+	// the task starts with a word longer than size: end after it
+	for {
+		if i := bytes.IndexFunc(s.buf, unicode.IsSpace); i >= 0 {
+			if s.buf[i] == '\n' {
+				return s.take(i, 1), nil
+			}
+			_, width := utf8.DecodeRune(s.buf[i:])
+			return s.take(i+width, 0), nil
+		}
+		if s.err == io.EOF {
+			return s.take(len(s.buf), 0), nil
+		}
+		s.fill(len(s.buf) + s.size)
+		if s.err != nil && s.err != io.EOF {
+			return "", s.err
+		}
+	}
+}
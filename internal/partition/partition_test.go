@@ -0,0 +1,368 @@
+package partition
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var one = json.RawMessage("1")
+
+func Test_Lines(t *testing.T) {
+	type args struct {
+		content string
+		n       int
+		sep     string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "test partition content",
+			args: args{
+				content: "lorem ipsum\ndolor sit\namet consectetur",
+				n:       3,
+				sep:     "\n",
+			},
+			want: []string{
+				"lorem ipsum",
+				"dolor sit",
+				"amet consectetur",
+			},
+		},
+		{
+			name: "test uneven number of lines",
+			args: args{
+				content: "lorem ipsum\ndolor sit\namet consectetur\nadipiscing elit",
+				n:       3,
+				sep:     "\n",
+			},
+			want: []string{
+				"lorem ipsum\ndolor sit",
+				"amet consectetur",
+				"adipiscing elit",
+			},
+		},
+		{
+			name: "test paragraphs",
+			args: args{
+				content: "lorem ipsum\ndolor sit\n\namet\nconsectetur\n\nadipiscing elit",
+				n:       2,
+				sep:     "\n\n",
+			},
+			want: []string{
+				"lorem ipsum\ndolor sit\n\namet\nconsectetur",
+				"\nadipiscing elit",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.args.content, tt.args.n, tt.args.sep)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Key(t *testing.T) {
+	type args struct {
+		key       string
+		shufflers int
+	}
+	tests := []struct {
+		name string
+		args args
+		want int
+	}{
+		{
+			name: "test get shuffler",
+			args: args{
+				key:       "lorem",
+				shufflers: 3,
+			},
+			want: 1,
+		},
+		{
+			name: "test get shuffler 2",
+			args: args{
+				key:       "dolor",
+				shufflers: 6,
+			},
+			want: 5,
+		},
+		{
+			name: "test get shuffler n-gram",
+			args: args{
+				key:       "lorem ipsum",
+				shufflers: 6,
+			},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Key(tt.args.key, tt.args.shufflers); got != tt.want {
+				t.Errorf("Key() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Rendezvous(t *testing.T) {
+
+	// keys of the form "key-0", "key-1", ...
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	assign := func(nodes []string) map[string]string {
+		r := NewRendezvous(nodes)
+		got := make(map[string]string, len(keys))
+		for _, key := range keys {
+			got[key] = nodes[r.Node(key)]
+		}
+		return got
+	}
+
+	nodes := []string{"shuffle-0", "shuffle-1", "shuffle-2", "shuffle-3", "shuffle-4"}
+	before := assign(nodes)
+
+	t.Run("test balanced", func(t *testing.T) {
+		counts := map[string]int{}
+		for _, node := range before {
+			counts[node]++
+		}
+		for _, node := range nodes {
+			assert.InDelta(t, len(keys)/len(nodes), counts[node], float64(len(keys))/20, node)
+		}
+	})
+
+	t.Run("test independent of the order", func(t *testing.T) {
+		reversed := []string{"shuffle-4", "shuffle-3", "shuffle-2", "shuffle-1", "shuffle-0"}
+		assert.Equal(t, before, assign(reversed))
+	})
+
+	t.Run("test scale up", func(t *testing.T) {
+		after := assign(append(nodes[:5:5], "shuffle-5"))
+		for _, key := range keys {
+			if after[key] != before[key] {
+				assert.Equal(t, "shuffle-5", after[key], key)
+			}
+		}
+	})
+
+	t.Run("test scale down", func(t *testing.T) {
+		after := assign(nodes[:4])
+		for _, key := range keys {
+			if before[key] != "shuffle-4" {
+				assert.Equal(t, before[key], after[key], key)
+			}
+		}
+	})
+
+	t.Run("test single node", func(t *testing.T) {
+		assert.Equal(t, 0, NewRendezvous([]string{"shuffle-0"}).Node("lorem"))
+	})
+}
+
+func Test_Groups(t *testing.T) {
+	type args struct {
+		shuffle map[string][]json.RawMessage
+		n       int
+	}
+	tests := []struct {
+		name string
+		args args
+	}{
+		{
+			name: "test partition shuffle",
+			args: args{
+				shuffle: map[string][]json.RawMessage{
+					"lorem":       {one, one, one},
+					"ipsum":       {one, one},
+					"dolor":       {one, one},
+					"sit":         {one},
+					"amet":        {one},
+					"consectetur": {one, one, one},
+				},
+				n: 3,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Groups(tt.args.shuffle, tt.args.n); len(got) != tt.args.n {
+				t.Errorf("Groups() = unexpected result: %v", got)
+			}
+		})
+	}
+}
+
+func Test_GroupsBalance(t *testing.T) {
+
+	// values returns a group of n values
+	values := func(n int) []json.RawMessage {
+		group := make([]json.RawMessage, n)
+		for i := range group {
+			group[i] = one
+		}
+		return group
+	}
+
+	shuffle := map[string][]json.RawMessage{
+		"the":   values(6),
+		"and":   values(3),
+		"lorem": values(3),
+		"ipsum": values(3),
+		"dolor": values(3),
+		"sit":   values(1),
+	}
+
+	// the largest group fills a part, the others share the remaining parts
+	// evenly, and the last group goes to the first of the tied parts
+	assert.Equal(t, []map[string][]json.RawMessage{
+		{"the": values(6), "sit": values(1)},
+		{"and": values(3), "ipsum": values(3)},
+		{"dolor": values(3), "lorem": values(3)},
+	}, Groups(shuffle, 3))
+}
+
+func Test_Sampler(t *testing.T) {
+
+	// "the" is 3 mappings out of 10 and "and" 1 out of 10, in a stream
+	// whose period is a multiple of the rate
+	s := NewSampler(2)
+	for i := 0; i < 1000; i++ {
+		for _, key := range []string{"the", "lorem", "the", "ipsum", "the", "dolor", "and", "sit", "amet", "elit"} {
+			s.Add(key)
+		}
+	}
+	hot := s.Hot(0.2)
+	assert.Len(t, hot, 1)
+	assert.InDelta(t, 0.3, hot["the"], 0.02)
+
+	// every key is over 5%
+	assert.Len(t, s.Hot(0.05), 8)
+
+	// too few samples to tell
+	s = NewSampler(1)
+	for i := 0; i < 10; i++ {
+		s.Add("the")
+	}
+	assert.Empty(t, s.Hot(0.5))
+}
+
+func Test_Splitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		size    int
+		sep     string
+		want    []string
+	}{
+		{
+			name:    "test one line per task",
+			content: "lorem ipsum\ndolor sit\namet consectetur",
+			size:    16,
+			want:    []string{"lorem ipsum", "dolor sit", "amet consectetur"},
+		},
+		{
+			name:    "test several lines per task",
+			content: "lorem ipsum\ndolor sit\namet consectetur\nadipiscing elit\n",
+			size:    21,
+			want:    []string{"lorem ipsum\ndolor sit", "amet consectetur", "adipiscing elit\n"},
+		},
+		{
+			name:    "test long line cut at spaces",
+			content: "lorem ipsum dolor sit amet",
+			size:    12,
+			want:    []string{"lorem ipsum ", "dolor sit ", "amet"},
+		},
+		{
+			name:    "test multi-byte runes",
+			content: "àèìòù àèìòù",
+			size:    12,
+			want:    []string{"àèìòù ", "àèìòù"},
+		},
+		{
+			name:    "test unicode space",
+			content: "lorem\u3000ipsum",
+			size:    9,
+			want:    []string{"lorem\u3000", "ipsum"},
+		},
+		{
+			name:    "test word longer than size",
+			content: "lorem consectetur\nipsum",
+			size:    3,
+			want:    []string{"lorem ", "consectetur", "ipsum"},
+		},
+		{
+			name:    "test whole content in one task",
+			content: "lorem ipsum\ndolor sit",
+			size:    1024,
+			want:    []string{"lorem ipsum\ndolor sit"},
+		},
+		{
+			name:    "test empty content",
+			content: "",
+			size:    1,
+			want:    nil,
+		},
+		{
+			name:    "test paragraphs",
+			content: "lorem ipsum\ndolor.\n\nsit amet\nconsectetur",
+			size:    24,
+			sep:     "\n\n",
+			want:    []string{"lorem ipsum\ndolor.", "\nsit amet\nconsectetur"},
+		},
+		{
+			name:    "test paragraph right after a full task",
+			content: "lorem\nipsum\n\ndolor",
+			size:    11,
+			sep:     "\n\n",
+			want:    []string{"lorem\nipsum", "\ndolor"},
+		},
+		{
+			name:    "test paragraph longer than size cut at lines",
+			content: "lorem ipsum\ndolor sit\n\namet",
+			size:    12,
+			sep:     "\n\n",
+			want:    []string{"lorem ipsum", "dolor sit", "\namet"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// read one byte at a time, as a slow upload would
+			sep := tt.sep
+			if sep == "" {
+				sep = "\n"
+			}
+			s := NewSplitter(iotest.OneByteReader(strings.NewReader(tt.content)), tt.size, sep)
+
+			var got []string
+			for {
+				task, err := s.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				got = append(got, task)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
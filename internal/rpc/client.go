@@ -0,0 +1,187 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Client sends tasks to the workers over gRPC.
+type Client struct {
+	opts []grpc.DialOption
+}
+
+// NewClient returns a client that dials the workers with the given options,
+// in addition to the default ones.
+func NewClient(opts ...grpc.DialOption) *Client {
+	defaults := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(Codec)),
+	}
+	return &Client{append(defaults, opts...)}
+}
+
+// Map sends a map task to the worker at addr and returns its mappings.
+func (c *Client) Map(ctx context.Context, addr string, params url.Values, content string) ([]kv.KV, error) {
+
+	tasks := []*Task{}
+	for _, chunk := range chunks(content) {
+		tasks = append(tasks, &Task{Content: chunk})
+	}
+
+	mappings := []kv.KV{}
+	err := c.call(ctx, addr, &mapperDesc, params, tasks, func(records []kv.KV) error {
+		mappings = append(mappings, records...)
+		return nil
+	})
+	return mappings, err
+}
+
+// Shuffle sends a shuffle task to the worker at addr and returns the values
+// of the mappings grouped by key.
+func (c *Client) Shuffle(ctx context.Context, addr string, params url.Values, mappings []kv.KV) (map[string][]json.RawMessage, error) {
+
+	tasks := []*Task{}
+	for _, batch := range batches(mappings) {
+		tasks = append(tasks, &Task{Records: batch})
+	}
+
+	shuffles := map[string][]json.RawMessage{}
+	err := c.call(ctx, addr, &shufflerDesc, params, tasks, func(records []kv.KV) error {
+		groups, err := recordGroups(records)
+		for key, values := range groups {
+			shuffles[key] = append(shuffles[key], values...)
+		}
+		return err
+	})
+	return shuffles, err
+}
+
+// ShuffleReduce sends a shuffle task to the worker at addr, which reduces the
+// groups of the mappings itself, and returns the final value of each key.
+func (c *Client) ShuffleReduce(ctx context.Context, addr string, params url.Values, mappings []kv.KV) (map[string]json.RawMessage, error) {
+
+	tasks := []*Task{}
+	for _, batch := range batches(mappings) {
+		tasks = append(tasks, &Task{Records: batch})
+	}
+
+	result := map[string]json.RawMessage{}
+	err := c.call(ctx, addr, &shuffleReducerDesc, params, tasks, func(records []kv.KV) error {
+		for _, record := range records {
+			result[record.Key] = record.Value
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Reduce sends a reduce task to the worker at addr and returns the final
+// value of each key.
+func (c *Client) Reduce(ctx context.Context, addr string, params url.Values, shuffle map[string][]json.RawMessage) (map[string]json.RawMessage, error) {
+
+	groups, err := groupRecords(shuffle)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []*Task{}
+	for _, batch := range batches(groups) {
+		tasks = append(tasks, &Task{Records: batch})
+	}
+
+	result := map[string]json.RawMessage{}
+	err = c.call(ctx, addr, &reducerDesc, params, tasks, func(records []kv.KV) error {
+		for _, record := range records {
+			result[record.Key] = record.Value
+		}
+		return nil
+	})
+	return result, err
+}
+
+// CheckHealth checks that the worker at addr answers that it is serving on
+// the standard gRPC health service.
+func (c *Client) CheckHealth(ctx context.Context, addr string) error {
+
+	conn, err := grpc.NewClient(addr, c.opts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the health service is encoded with protobuf, not with the codec of the
+	// tasks
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.CallContentSubtype("proto"))
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("%s answered %s", addr, resp.GetStatus())
+	}
+	return nil
+}
+
+// call streams the chunks of a task to the worker at addr on a new connection,
+// and calls recv for each batch of records streamed back. Using a new
+// connection for each task lets a load balanced service route the tasks to
+// different workers.
+func (c *Client) call(ctx context.Context, addr string, desc *grpc.ServiceDesc, params url.Values, tasks []*Task, recv func([]kv.KV) error) error {
+
+	conn, err := grpc.NewClient(addr, c.opts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	method := "/" + desc.ServiceName + "/" + desc.Streams[0].StreamName
+	stream, err := conn.NewStream(ctx, &desc.Streams[0], method)
+	if err != nil {
+		return err
+	}
+
+	// send the task while receiving the records, since the worker may answer
+	// before it has received the whole task
+	sendErr := make(chan error, 1)
+	go func() {
+		tasks[0].Params = params
+		for _, task := range tasks {
+			if err := stream.SendMsg(task); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- stream.CloseSend()
+	}()
+
+	for {
+		records := &Records{}
+		err := stream.RecvMsg(records)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := recv(records.Records); err != nil {
+			return err
+		}
+	}
+
+	// SendMsg returns io.EOF when the stream was aborted by the worker, and
+	// the actual error is then returned by RecvMsg
+	if err := <-sendErr; err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
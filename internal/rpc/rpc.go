@@ -0,0 +1,98 @@
+// Package rpc implements the gRPC transport between the coordinator and the
+// map, shuffle and reduce workers.
+//
+// Each worker role is a gRPC service with a single bidirectional streaming
+// method: the coordinator streams the task in chunks and the worker streams
+// back the resulting records, so that neither side has to hold a whole task
+// payload in one message. Messages are encoded as JSON with the codec
+// registered by this package.
+//
+//	service Mapper   { rpc Map(stream Task) returns (stream Records); }
+//	service Shuffler { rpc Shuffle(stream Task) returns (stream Records); }
+//	service Reducer  { rpc Reduce(stream Task) returns (stream Records); }
+//
+// The shuffle workers also serve the ShuffleReducer service, which groups
+// the mappings like Shuffle and reduces the groups like Reduce, so that the
+// groups never leave the worker:
+//
+//	service ShuffleReducer { rpc ShuffleReduce(stream Task) returns (stream Records); }
+package rpc
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"google.golang.org/grpc/encoding"
+)
+
+// Task is a chunk of a task streamed from the coordinator to a worker. The
+// first chunk of a task also carries the parameters of the job.
+type Task struct {
+	Params map[string][]string `json:"params,omitempty"`
+
+	// Content is the chunk of the document of a map task.
+	Content string `json:"content,omitempty"`
+
+	// Records are the mappings of a shuffle task or the groups of a reduce
+	// task. The value of a group is the JSON array of its values.
+	Records []kv.KV `json:"records,omitempty"`
+}
+
+// Records is a batch of records streamed from a worker to the coordinator.
+type Records struct {
+	Records []kv.KV `json:"records"`
+}
+
+// chunkSize is the approximate size, in bytes, of the chunks of a map task.
+const chunkSize = 64 * 1024
+
+// batchSize is the number of records in each streamed message.
+const batchSize = 1024
+
+// Codec is the name of the codec used for the messages.
+const Codec = "json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return Codec
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// batches splits records into batches of at most batchSize records.
+func batches(records []kv.KV) [][]kv.KV {
+	b := [][]kv.KV{}
+	for len(records) > batchSize {
+		b = append(b, records[:batchSize])
+		records = records[batchSize:]
+	}
+	return append(b, records)
+}
+
+// chunks splits content into chunks of about chunkSize bytes. Chunks are cut
+// at line boundaries, so that lines are never split across chunks, and the
+// newline between two chunks is dropped.
+func chunks(content string) []string {
+	c := []string{}
+	for len(content) > chunkSize {
+		i := strings.IndexByte(content[chunkSize:], '\n')
+		if i < 0 {
+			break
+		}
+		c = append(c, content[:chunkSize+i])
+		content = content[chunkSize+i+1:]
+	}
+	return append(c, content)
+}
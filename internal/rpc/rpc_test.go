@@ -0,0 +1,255 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/job"
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var one = json.RawMessage("1")
+
+// newTestClient serves the worker services on an in-process connection and
+// returns a client connected to them.
+func newTestClient(t *testing.T) *Client {
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	RegisterMapper(s)
+	RegisterShuffler(s)
+	RegisterReducer(s)
+	RegisterHealth(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	return NewClient(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+}
+
+func Test_chunks(t *testing.T) {
+	line := strings.Repeat("lorem ", chunkSize/6+1)
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{
+			name:    "test small content",
+			content: "lorem ipsum\ndolor sit",
+			want:    1,
+		},
+		{
+			name:    "test content split at lines",
+			content: line + "\n" + line + "\n" + line,
+			want:    3,
+		},
+		{
+			name:    "test single long line",
+			content: strings.Repeat("lorem ", chunkSize),
+			want:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunks(tt.content)
+			assert.Equalf(t, tt.want, len(got), "chunks() returned %d chunks, want %d", len(got), tt.want)
+			assert.Equal(t, strings.Count(tt.content, "lorem"), strings.Count(strings.Join(got, "\n"), "lorem"))
+		})
+	}
+}
+
+func Test_Map(t *testing.T) {
+	client := newTestClient(t)
+
+	tests := []struct {
+		name     string
+		params   url.Values
+		content  string
+		want     []kv.KV
+		wantCode codes.Code
+	}{
+		{
+			name:    "test map",
+			params:  url.Values{"job": {"wordcount"}},
+			content: "lorem Lorem\nipsum",
+			want: []kv.KV{
+				{Key: "lorem", Value: one},
+				{Key: "lorem", Value: one},
+				{Key: "ipsum", Value: one},
+			},
+		},
+		{
+			name:    "test map with combiner",
+			params:  url.Values{"job": {"wordcount"}, "combine": {"true"}},
+			content: strings.Repeat("lorem ipsum\n", chunkSize),
+			want: []kv.KV{
+				{Key: "ipsum", Value: json.RawMessage("65536")},
+				{Key: "lorem", Value: json.RawMessage("65536")},
+			},
+		},
+		{
+			name:     "test unknown job",
+			params:   url.Values{"job": {"unknown"}},
+			content:  "lorem ipsum",
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.Map(context.Background(), "passthrough:///bufnet", tt.params, tt.content)
+			if tt.wantCode != codes.OK {
+				assert.Equalf(t, tt.wantCode, status.Code(err), "Map() = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			assert.NoError(t, err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Map() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_MapLikeLocal(t *testing.T) {
+	client := newTestClient(t)
+
+	// a sentence that spans lines is longer than a chunk, so its n-grams
+	// cross the boundaries of the chunks
+	sentence := strings.Repeat("lorem ipsum dolor\n", chunkSize/8) + "sit amet."
+	tests := []struct {
+		name    string
+		params  url.Values
+		content string
+	}{
+		{
+			name:    "test sentence longer than a chunk",
+			params:  url.Values{"job": {"wordcount"}, "ngrams": {"2"}, "boundary": {"sentence"}},
+			content: sentence + " " + sentence,
+		},
+		{
+			name:    "test blank lines between chunks",
+			params:  url.Values{"job": {"wordcount"}, "ngrams": {"2"}, "boundary": {"sentence"}},
+			content: "\n\n" + strings.Repeat("lorem ipsum\n\n", chunkSize/4),
+		},
+		{
+			name:    "test paragraphs across chunks",
+			params:  url.Values{"job": {"wordcount"}, "ngrams": {"2"}, "boundary": {"sentence"}},
+			content: strings.Repeat("lorem ipsum\ndolor sit\n\n\namet\n", chunkSize/8),
+		},
+		{
+			name:    "test empty lines across chunks",
+			params:  url.Values{"job": {"grep"}, "pattern": {"^$"}},
+			content: strings.Repeat("lorem ipsum\n\n\n", chunkSize/4),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Greater(t, len(chunks(tt.content)), 1)
+
+			j, err := job.Lookup(tt.params.Get("job"))
+			assert.NoError(t, err)
+			want, err := j.Map(tt.content, tt.params)
+			assert.NoError(t, err)
+
+			got, err := client.Map(context.Background(), "passthrough:///bufnet", tt.params, tt.content)
+			assert.NoError(t, err)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Map() returned %d mappings, want the %d mappings of the local map", len(got), len(want))
+			}
+		})
+	}
+}
+
+func Test_Shuffle(t *testing.T) {
+	client := newTestClient(t)
+
+	mappings := []kv.KV{}
+	for i := 0; i < 3*batchSize; i++ {
+		mappings = append(mappings, kv.KV{Key: "lorem", Value: one}, kv.KV{Key: "ipsum", Value: one})
+	}
+
+	got, err := client.Shuffle(context.Background(), "passthrough:///bufnet", url.Values{}, mappings)
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Len(t, got["lorem"], 3*batchSize)
+	assert.Len(t, got["ipsum"], 3*batchSize)
+}
+
+func Test_ShuffleReduce(t *testing.T) {
+	client := newTestClient(t)
+
+	mappings := []kv.KV{}
+	for i := 0; i < 3*batchSize; i++ {
+		mappings = append(mappings, kv.KV{Key: "lorem", Value: one}, kv.KV{Key: "ipsum", Value: one})
+	}
+	mappings = append(mappings, kv.KV{Key: "lorem", Value: one})
+
+	got, err := client.ShuffleReduce(context.Background(), "passthrough:///bufnet", url.Values{"job": {"wordcount"}}, mappings)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]json.RawMessage{
+		"lorem": json.RawMessage(strconv.Itoa(3*batchSize + 1)),
+		"ipsum": json.RawMessage(strconv.Itoa(3 * batchSize)),
+	}, got)
+
+	_, err = client.ShuffleReduce(context.Background(), "passthrough:///bufnet", url.Values{"job": {"unknown"}}, mappings)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ShuffleReduce(context.Background(), "passthrough:///bufnet", url.Values{"job": {"wordcount"}, "top": {"all"}}, mappings)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func Test_Reduce(t *testing.T) {
+	client := newTestClient(t)
+
+	shuffle := map[string][]json.RawMessage{
+		"lorem": {one, json.RawMessage("2")},
+		"ipsum": {one},
+	}
+	want := map[string]json.RawMessage{
+		"lorem": json.RawMessage("3"),
+		"ipsum": one,
+	}
+
+	got, err := client.Reduce(context.Background(), "passthrough:///bufnet", url.Values{"job": {"wordcount"}}, shuffle)
+	assert.NoError(t, err)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Reduce() = %s, want %s", got, want)
+	}
+
+	// the top K is selected among the keys of all the batches of the task
+	shuffle = map[string][]json.RawMessage{}
+	for i := range 3 * batchSize {
+		shuffle[strconv.Itoa(i)] = []json.RawMessage{json.RawMessage(strconv.Itoa(i))}
+	}
+	params := url.Values{"job": {"wordcount"}, "top": {"2"}}
+	got, err = client.Reduce(context.Background(), "passthrough:///bufnet", params, shuffle)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]json.RawMessage{
+		strconv.Itoa(3*batchSize - 1): json.RawMessage(strconv.Itoa(3*batchSize - 1)),
+		strconv.Itoa(3*batchSize - 2): json.RawMessage(strconv.Itoa(3*batchSize - 2)),
+	}, got)
+
+	// the parameters are checked before reducing, so that the task is not
+	// retried
+	params = url.Values{"job": {"invertedindex"}, "top": {"2"}}
+	_, err = client.Reduce(context.Background(), "passthrough:///bufnet", params, shuffle)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func Test_CheckHealth(t *testing.T) {
+	client := newTestClient(t)
+
+	err := client.CheckHealth(context.Background(), "passthrough:///bufnet")
+	assert.NoError(t, err)
+}
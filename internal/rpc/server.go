@@ -0,0 +1,358 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+
+	"github.com/FDeRubeis/mapreduce/internal/job"
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Worker is the interface of the worker services. It has no methods: the
+// streams are served by the handlers of the service descriptions.
+type Worker interface{}
+
+var mapperDesc = grpc.ServiceDesc{
+	ServiceName: "mapreduce.Mapper",
+	HandlerType: (*Worker)(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Map", Handler: serveMap, ServerStreams: true, ClientStreams: true},
+	},
+}
+
+var shufflerDesc = grpc.ServiceDesc{
+	ServiceName: "mapreduce.Shuffler",
+	HandlerType: (*Worker)(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Shuffle", Handler: serveShuffle, ServerStreams: true, ClientStreams: true},
+	},
+}
+
+var shuffleReducerDesc = grpc.ServiceDesc{
+	ServiceName: "mapreduce.ShuffleReducer",
+	HandlerType: (*Worker)(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "ShuffleReduce", Handler: serveShuffleReduce, ServerStreams: true, ClientStreams: true},
+	},
+}
+
+var reducerDesc = grpc.ServiceDesc{
+	ServiceName: "mapreduce.Reducer",
+	HandlerType: (*Worker)(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Reduce", Handler: serveReduce, ServerStreams: true, ClientStreams: true},
+	},
+}
+
+// RegisterMapper registers the map service on a gRPC server.
+func RegisterMapper(s *grpc.Server) {
+	s.RegisterService(&mapperDesc, struct{}{})
+}
+
+// RegisterShuffler registers the shuffle service on a gRPC server, with the
+// ShuffleReducer service.
+func RegisterShuffler(s *grpc.Server) {
+	s.RegisterService(&shufflerDesc, struct{}{})
+	s.RegisterService(&shuffleReducerDesc, struct{}{})
+}
+
+// RegisterReducer registers the reduce service on a gRPC server.
+func RegisterReducer(s *grpc.Server) {
+	s.RegisterService(&reducerDesc, struct{}{})
+}
+
+// RegisterHealth registers the standard gRPC health service on a gRPC server,
+// which answers that the worker is serving while the server is up.
+func RegisterHealth(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, health.NewServer())
+}
+
+// receive calls fn for each chunk of the task streamed by the client, until
+// the client closes its side of the stream. It returns the parameters of the
+// job, carried by the first chunk.
+func receive(stream grpc.ServerStream, fn func(params url.Values, task *Task) error) (url.Values, error) {
+
+	var params url.Values
+	for {
+		task := &Task{}
+		err := stream.RecvMsg(task)
+		if errors.Is(err, io.EOF) {
+			return params, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if params == nil {
+			params = url.Values(task.Params)
+			if params == nil {
+				params = url.Values{}
+			}
+		}
+		if err := fn(params, task); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send streams records to the client in batches.
+func send(stream grpc.ServerStream, records []kv.KV) error {
+	for _, batch := range batches(records) {
+		if err := stream.SendMsg(&Records{batch}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lookupJob(params url.Values) (*job.Job, error) {
+	j, err := job.Lookup(params.Get("job"))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return j, nil
+}
+
+// lookupReduceJob returns the job of a reduce task after checking its
+// parameters, so that a task that cannot succeed is not retried.
+func lookupReduceJob(params url.Values) (*job.Job, error) {
+	j, err := lookupJob(params)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := j.ParseTopK(params); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return j, nil
+}
+
+func serveMap(_ any, stream grpc.ServerStream) error {
+
+	logger := logging.FromContext(stream.Context())
+
+	// map the task as it arrives, up to the last separator of the job
+	// received, and keep only the part that has not ended: the mappings of
+	// the parts do not depend on the rest of the task, even for the jobs
+	// that read across lines, such as the n-grams of a sentence, which are
+	// only cut at blank lines. The newline between two chunks was dropped
+	// when the task was cut.
+	var j *job.Job
+	pairs := []kv.KV{}
+	mapPart := func(params url.Values, content []byte) error {
+		part, err := j.Map(string(content), params)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		pairs = append(pairs, part...)
+		return nil
+	}
+	var pending []byte
+	received := 0
+	params, err := receive(stream, func(params url.Values, task *Task) error {
+		if j == nil {
+			var err error
+			if j, err = lookupJob(params); err != nil {
+				return err
+			}
+		}
+
+		if received > 0 {
+			pending = append(pending, '\n')
+		}
+		pending = append(pending, task.Content...)
+		received++
+
+		i := bytes.LastIndex(pending, []byte(job.TaskSeparator(params)))
+		if i < 0 {
+			return nil
+		}
+		if err := mapPart(params, pending[:i]); err != nil {
+			return err
+		}
+		pending = append(pending[:0], pending[i+1:]...)
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("Error receiving map task: %s", err)
+		return err
+	}
+	if j == nil {
+		if j, err = lookupJob(params); err != nil {
+			return err
+		}
+	}
+
+	if err := mapPart(params, pending); err != nil {
+		logger.Errorf("Error mapping task: %s", err)
+		return err
+	}
+
+	pairs, err = j.RunCombine(pairs, params)
+	if err != nil {
+		logger.Errorf("Error combining mappings: %s", err)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := send(stream, pairs); err != nil {
+		logger.Errorf("Error sending mappings: %s", err)
+		return err
+	}
+
+	logger.Infof("Successfully ran %s map on %d mappings", j.Name, len(pairs))
+	return nil
+}
+
+func serveShuffle(_ any, stream grpc.ServerStream) error {
+
+	logger := logging.FromContext(stream.Context())
+
+	// group the mappings as they arrive
+	shuffles := map[string][]json.RawMessage{}
+	_, err := receive(stream, func(_ url.Values, task *Task) error {
+		for _, mapping := range task.Records {
+			shuffles[mapping.Key] = append(shuffles[mapping.Key], mapping.Value)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("Error receiving shuffle task: %s", err)
+		return err
+	}
+
+	groups, err := groupRecords(shuffles)
+	if err != nil {
+		logger.Errorf("Error encoding shuffles: %s", err)
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	if err := send(stream, groups); err != nil {
+		logger.Errorf("Error sending shuffles: %s", err)
+		return err
+	}
+
+	logger.Infof("Successfully shuffled %d keys", len(groups))
+	return nil
+}
+
+func serveShuffleReduce(_ any, stream grpc.ServerStream) error {
+
+	logger := logging.FromContext(stream.Context())
+
+	// group the mappings as they arrive, and reduce the groups once they
+	// are complete
+	shuffles := map[string][]json.RawMessage{}
+	params, err := receive(stream, func(_ url.Values, task *Task) error {
+		for _, mapping := range task.Records {
+			shuffles[mapping.Key] = append(shuffles[mapping.Key], mapping.Value)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("Error receiving shuffle task: %s", err)
+		return err
+	}
+
+	j, err := lookupReduceJob(params)
+	if err != nil {
+		logger.Errorf("Invalid reduce task: %s", err)
+		return err
+	}
+	result, err := j.RunReduce(shuffles, params)
+	if err != nil {
+		logger.Errorf("Error reducing values: %s", err)
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	records := make([]kv.KV, 0, len(result))
+	for key, value := range result {
+		records = append(records, kv.KV{Key: key, Value: value})
+	}
+	if err := send(stream, records); err != nil {
+		logger.Errorf("Error sending final values: %s", err)
+		return err
+	}
+
+	logger.Infof("Successfully shuffled and reduced %d keys", len(shuffles))
+	return nil
+}
+
+func serveReduce(_ any, stream grpc.ServerStream) error {
+
+	logger := logging.FromContext(stream.Context())
+
+	// group the whole task before reducing it, since the top K of the task
+	// can only be selected once all its keys are reduced
+	shuffle := map[string][]json.RawMessage{}
+	params, err := receive(stream, func(_ url.Values, task *Task) error {
+		groups, err := recordGroups(task.Records)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		for key, values := range groups {
+			shuffle[key] = append(shuffle[key], values...)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("Error receiving reduce task: %s", err)
+		return err
+	}
+
+	j, err := lookupReduceJob(params)
+	if err != nil {
+		logger.Errorf("Invalid reduce task: %s", err)
+		return err
+	}
+	result, err := j.RunReduce(shuffle, params)
+	if err != nil {
+		logger.Errorf("Error reducing values: %s", err)
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	records := make([]kv.KV, 0, len(result))
+	for key, value := range result {
+		records = append(records, kv.KV{Key: key, Value: value})
+	}
+	if err := send(stream, records); err != nil {
+		logger.Errorf("Error sending final values: %s", err)
+		return err
+	}
+
+	logger.Infof("Successfully reduced %d keys", len(shuffle))
+	return nil
+}
+
+// groupRecords encodes groups as records whose values are JSON arrays.
+func groupRecords(groups map[string][]json.RawMessage) ([]kv.KV, error) {
+	records := make([]kv.KV, 0, len(groups))
+	for key, values := range groups {
+		encoded, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, kv.KV{Key: key, Value: encoded})
+	}
+	return records, nil
+}
+
+// recordGroups decodes the groups encoded by groupRecords.
+func recordGroups(records []kv.KV) (map[string][]json.RawMessage, error) {
+	groups := make(map[string][]json.RawMessage, len(records))
+	for _, record := range records {
+		values := []json.RawMessage{}
+		if err := json.Unmarshal(record.Value, &values); err != nil {
+			return nil, err
+		}
+		groups[record.Key] = append(groups[record.Key], values...)
+	}
+	return groups, nil
+}
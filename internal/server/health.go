@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// checkTimeout bounds the readiness checks of a probe.
+const checkTimeout = 2 * time.Second
+
+// Check is a readiness check, such as a dependency that must be reachable.
+type Check struct {
+	Name string
+	// Check returns an error when the service cannot do its work.
+	Check func(ctx context.Context) error
+}
+
+// HealthHandler answers 200 as long as the process serves requests. It is
+// the liveness endpoint, and does not depend on anything else.
+func (s *Service) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// ReadyHandler answers 200 while the service accepts work and 503 while it
+// drains, while it has MaxInflight requests in flight or while one of its
+// checks fails. The body lists the reasons.
+func (s *Service) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+
+	if s.Draining() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+
+	if n := s.inflight.Load(); s.MaxInflight > 0 && n >= int64(s.MaxInflight) {
+		http.Error(w, fmt.Sprintf("overloaded: %d tasks in flight", n), http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	// run the checks concurrently, and report them in order
+	errs := make([]error, len(s.Checks))
+	var wg sync.WaitGroup
+	for i, c := range s.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.Check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	failures := []string{}
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", s.Checks[i].Name, err))
+		}
+	}
+	if len(failures) > 0 {
+		http.Error(w, strings.Join(failures, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+// Track counts the requests in flight to h as the load of the service.
+func (s *Service) Track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inflight.Add(1)
+		defer s.inflight.Add(-1)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// StreamInterceptor counts the gRPC calls in flight as the load of the
+// service.
+func (s *Service) StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+	return handler(srv, ss)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func Test_Service_ReadyHandler(t *testing.T) {
+
+	ok := Check{Name: "ok", Check: func(ctx context.Context) error { return nil }}
+	down := Check{Name: "down", Check: func(ctx context.Context) error { return errors.New("connection refused") }}
+
+	tests := []struct {
+		name       string
+		service    *Service
+		drain      bool
+		inflight   int64
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "test ready",
+			service:    &Service{Checks: []Check{ok}},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok\n",
+		},
+		{
+			name:       "test draining",
+			service:    &Service{Checks: []Check{ok}},
+			drain:      true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "draining\n",
+		},
+		{
+			name:       "test overloaded",
+			service:    &Service{MaxInflight: 2},
+			inflight:   2,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "overloaded: 2 tasks in flight\n",
+		},
+		{
+			name:       "test below the load limit",
+			service:    &Service{MaxInflight: 2},
+			inflight:   1,
+			wantStatus: http.StatusOK,
+			wantBody:   "ok\n",
+		},
+		{
+			name:       "test failed checks",
+			service:    &Service{Checks: []Check{down, ok, {Name: "slow", Check: func(ctx context.Context) error { return context.DeadlineExceeded }}}},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "down: connection refused\nslow: context deadline exceeded\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.drain {
+				tt.service.Drain()
+			}
+			tt.service.inflight.Store(tt.inflight)
+
+			w := httptest.NewRecorder()
+			tt.service.ReadyHandler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_Service_Track(t *testing.T) {
+	s := &Service{MaxInflight: 1}
+
+	var during int64
+	h := s.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = s.inflight.Load()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, int64(1), during)
+	assert.Equal(t, int64(0), s.inflight.Load())
+
+	err := s.StreamInterceptor(nil, nil, &grpc.StreamServerInfo{}, func(srv any, stream grpc.ServerStream) error {
+		during = s.inflight.Load()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), during)
+	assert.Equal(t, int64(0), s.inflight.Load())
+}
@@ -0,0 +1,195 @@
+// Package server runs the HTTP and gRPC servers of a service and shuts them
+// down without losing the work in flight.
+//
+// On shutdown a service first drains: it keeps serving but fails its
+// readiness check, so that Kubernetes takes it out of the endpoints of its
+// Service before it stops accepting connections. It then waits for the
+// requests in flight, and for any work that outlives the requests, until the
+// shutdown timeout.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// Defaults of the drain period and the shutdown timeout. Their sum should be
+// below the termination grace period of the pods.
+const (
+	DefaultDrainPeriod     = 5 * time.Second
+	DefaultShutdownTimeout = 20 * time.Second
+)
+
+// Default listen addresses of the servers.
+const (
+	DefaultHTTPAddr = ":80"
+	DefaultGRPCAddr = ":9090"
+)
+
+// Service is an HTTP server, optionally paired with a gRPC server. The zero
+// Service is ready and not draining.
+type Service struct {
+	// HTTP serves on HTTP.Addr.
+	HTTP *http.Server
+	// GRPC, if set, serves on GRPCAddr.
+	GRPC     *grpc.Server
+	GRPCAddr string
+
+	// Wait, if set, waits for the work that outlives the requests, such as
+	// asynchronous jobs, until ctx is done.
+	Wait func(ctx context.Context) error
+
+	// DrainPeriod is how long the service keeps serving, while failing its
+	// readiness check, before it stops accepting connections.
+	DrainPeriod time.Duration
+	// ShutdownTimeout is how long the work in flight has to finish once the
+	// service stops accepting connections.
+	ShutdownTimeout time.Duration
+
+	// Checks are the readiness checks of the service, besides its drain
+	// state and its load.
+	Checks []Check
+	// MaxInflight, if positive, is the number of tracked requests in flight
+	// at which the service stops being ready.
+	MaxInflight int
+
+	draining atomic.Bool
+	inflight atomic.Int64
+}
+
+// Register registers the settings of the service: http-addr, grpc-addr if
+// it has a gRPC server, drain-period, shutdown-timeout and
+// max-inflight-tasks. HTTP, and GRPC if any, must be set.
+func (s *Service) Register(c *config.Set) {
+	c.AddrVar(&s.HTTP.Addr, "http-addr", DefaultHTTPAddr, "listen address of the HTTP server")
+	if s.GRPC != nil {
+		c.AddrVar(&s.GRPCAddr, "grpc-addr", DefaultGRPCAddr, "listen address of the gRPC server")
+	}
+	c.DurationVar(&s.DrainPeriod, "drain-period", DefaultDrainPeriod, "how long to keep serving, while not ready, on shutdown")
+	c.DurationVar(&s.ShutdownTimeout, "shutdown-timeout", DefaultShutdownTimeout, "how long the work in flight has to finish on shutdown")
+	c.IntVar(&s.MaxInflight, "max-inflight-tasks", 0, 0, "tasks in flight at which the service stops being ready, 0 for no limit")
+}
+
+// Drain marks the service as draining. It is called by Run on shutdown.
+func (s *Service) Drain() {
+	s.draining.Store(true)
+}
+
+// Draining reports whether the service is shutting down. A draining service
+// should not accept new work.
+func (s *Service) Draining() bool {
+	return s.draining.Load()
+}
+
+// Run listens on the addresses of the servers and serves until ctx is done,
+// then shuts the service down. It returns nil after a clean shutdown.
+func (s *Service) Run(ctx context.Context) error {
+
+	httpLis, err := net.Listen("tcp", s.HTTP.Addr)
+	if err != nil {
+		return err
+	}
+
+	var grpcLis net.Listener
+	if s.GRPC != nil {
+		grpcLis, err = net.Listen("tcp", s.GRPCAddr)
+		if err != nil {
+			httpLis.Close()
+			return err
+		}
+	}
+
+	return s.Serve(ctx, httpLis, grpcLis)
+}
+
+// Serve is Run on the given listeners. grpcLis is ignored if the service
+// has no gRPC server.
+func (s *Service) Serve(ctx context.Context, httpLis, grpcLis net.Listener) error {
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- s.HTTP.Serve(httpLis)
+	}()
+	if s.GRPC != nil {
+		go func() {
+			errs <- s.GRPC.Serve(grpcLis)
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		s.HTTP.Close()
+		if s.GRPC != nil {
+			s.GRPC.Stop()
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	return s.shutdown()
+}
+
+// shutdown drains the service, then stops the servers and waits for the work
+// in flight.
+func (s *Service) shutdown() error {
+
+	log.Infof("Draining for %s", s.DrainPeriod)
+	s.Drain()
+	time.Sleep(s.DrainPeriod)
+
+	log.Infof("Shutting down, waiting up to %s for the work in flight", s.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+
+	// the gRPC server stops alongside the HTTP server
+	grpcErr := make(chan error, 1)
+	if s.GRPC != nil {
+		go func() {
+			grpcErr <- s.stopGRPC(ctx)
+		}()
+	} else {
+		grpcErr <- nil
+	}
+
+	var errs []error
+	if err := s.HTTP.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("shutting down the HTTP server: %w", err))
+	}
+	if err := <-grpcErr; err != nil {
+		errs = append(errs, fmt.Errorf("shutting down the gRPC server: %w", err))
+	}
+
+	if s.Wait != nil {
+		if err := s.Wait(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("waiting for the work in flight: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// stopGRPC waits for the gRPC calls in flight until ctx is done, then cancels
+// the remaining ones.
+func (s *Service) stopGRPC(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.GRPC.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.GRPC.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func Test_Service_Register(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		grpc         bool
+		wantHTTPAddr string
+		wantGRPCAddr string
+		wantDrain    time.Duration
+		wantShutdown time.Duration
+		wantInflight int
+		wantErr      string
+	}{
+		{
+			name:         "test defaults",
+			wantHTTPAddr: DefaultHTTPAddr,
+			wantDrain:    DefaultDrainPeriod,
+			wantShutdown: DefaultShutdownTimeout,
+		},
+		{
+			name:         "test gRPC defaults",
+			grpc:         true,
+			wantHTTPAddr: DefaultHTTPAddr,
+			wantGRPCAddr: DefaultGRPCAddr,
+			wantDrain:    DefaultDrainPeriod,
+			wantShutdown: DefaultShutdownTimeout,
+		},
+		{
+			name:         "test configured settings",
+			env:          map[string]string{"HTTP_ADDR": ":8080", "GRPC_ADDR": "127.0.0.1:9091", "DRAIN_PERIOD": "0", "SHUTDOWN_TIMEOUT": "1m", "MAX_INFLIGHT_TASKS": "8"},
+			grpc:         true,
+			wantHTTPAddr: ":8080",
+			wantGRPCAddr: "127.0.0.1:9091",
+			wantDrain:    0,
+			wantShutdown: time.Minute,
+			wantInflight: 8,
+		},
+		{
+			name:    "test invalid address",
+			env:     map[string]string{"HTTP_ADDR": "8080"},
+			wantErr: "invalid HTTP_ADDR: 8080: not a host:port address",
+		},
+		{
+			name:    "test invalid drain period",
+			env:     map[string]string{"DRAIN_PERIOD": "-1s"},
+			wantErr: "invalid DRAIN_PERIOD: -1s: must not be negative",
+		},
+		{
+			name:    "test invalid shutdown timeout",
+			env:     map[string]string{"SHUTDOWN_TIMEOUT": "later"},
+			wantErr: "invalid SHUTDOWN_TIMEOUT: later: not a duration",
+		},
+		{
+			name:    "test invalid load limit",
+			env:     map[string]string{"MAX_INFLIGHT_TASKS": "many"},
+			wantErr: "invalid MAX_INFLIGHT_TASKS: many: not an integer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"HTTP_ADDR", "GRPC_ADDR", "DRAIN_PERIOD", "SHUTDOWN_TIMEOUT", "MAX_INFLIGHT_TASKS"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			s := &Service{HTTP: &http.Server{}}
+			if tt.grpc {
+				s.GRPC = grpc.NewServer()
+			}
+			settings := config.New("test")
+			s.Register(settings)
+			err := settings.Load(nil)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantHTTPAddr, s.HTTP.Addr)
+			assert.Equal(t, tt.wantGRPCAddr, s.GRPCAddr)
+			assert.Equal(t, tt.wantDrain, s.DrainPeriod)
+			assert.Equal(t, tt.wantShutdown, s.ShutdownTimeout)
+			assert.Equal(t, tt.wantInflight, s.MaxInflight)
+		})
+	}
+}
+
+func Test_Service_Serve(t *testing.T) {
+	tests := []struct {
+		name            string
+		shutdownTimeout time.Duration
+		// release is whether the request in flight finishes in time
+		release bool
+		wantErr string
+	}{
+		{
+			name:            "test graceful shutdown",
+			shutdownTimeout: 5 * time.Second,
+			release:         true,
+		},
+		{
+			name:            "test shutdown timeout",
+			shutdownTimeout: 50 * time.Millisecond,
+			wantErr:         "shutting down the HTTP server: context deadline exceeded\nwaiting for the work in flight: context deadline exceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			defer close(release)
+
+			s := &Service{
+				DrainPeriod:     50 * time.Millisecond,
+				ShutdownTimeout: tt.shutdownTimeout,
+				GRPC:            grpc.NewServer(),
+			}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				<-release
+				io.WriteString(w, "done")
+			})
+			s.HTTP = &http.Server{Handler: mux}
+
+			// the work outliving the requests finishes with the request
+			waited := false
+			s.Wait = func(ctx context.Context) error {
+				waited = true
+				if tt.release {
+					return nil
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			}
+
+			httpLis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			grpcLis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			served := make(chan error, 1)
+			go func() {
+				served <- s.Serve(ctx, httpLis, grpcLis)
+			}()
+
+			// a request in flight when the shutdown starts
+			type response struct {
+				body string
+				err  error
+			}
+			responses := make(chan response, 1)
+			go func() {
+				resp, err := http.Get("http://" + httpLis.Addr().String())
+				if err != nil {
+					responses <- response{err: err}
+					return
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				responses <- response{string(body), err}
+			}()
+			<-started
+
+			cancel()
+			for !s.Draining() {
+				time.Sleep(time.Millisecond)
+			}
+			if tt.release {
+				release <- struct{}{}
+				resp := <-responses
+				assert.NoError(t, resp.err)
+				assert.Equal(t, "done", resp.body)
+			}
+
+			err = <-served
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.True(t, waited)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package tokenize
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Filter decides which tokens are emitted. A token is dropped if it is a stop
+// word or, when a vocabulary is given, if it is not part of it. A nil Filter
+// keeps all the tokens.
+type Filter struct {
+	stop       map[string]bool
+	vocabulary map[string]bool
+}
+
+// Keep reports whether the token should be emitted.
+func (f *Filter) Keep(token string) bool {
+	if f == nil {
+		return true
+	}
+	if f.vocabulary != nil && !f.vocabulary[token] {
+		return false
+	}
+	return !f.stop[token]
+}
+
+// FilterFromParams returns the filter chosen by the request parameters:
+//
+//	stopwords   comma-separated names of built-in stop-word lists, such as "en,de"
+//	exclude     comma-separated stop words
+//	vocabulary  comma-separated words, the only ones to keep
+//
+// The words of the lists go through the tokenizer t, so that they match the
+// tokens they filter. It returns nil if no filter is requested.
+func FilterFromParams(params url.Values, t *Tokenizer) (*Filter, error) {
+
+	f := &Filter{}
+	for _, name := range list(params.Get("stopwords")) {
+		words, ok := StopWords[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown stop-word list: %q", name)
+		}
+		f.stop = addTokens(f.stop, words, t)
+	}
+	f.stop = addTokens(f.stop, list(params.Get("exclude")), t)
+
+	if params.Has("vocabulary") {
+		f.vocabulary = addTokens(map[string]bool{}, list(params.Get("vocabulary")), t)
+	}
+
+	if f.stop == nil && f.vocabulary == nil {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// list splits a comma-separated parameter.
+func list(param string) []string {
+	var items []string
+	for _, item := range strings.Split(param, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// addTokens adds the tokens of words to set, creating it if needed.
+func addTokens(set map[string]bool, words []string, t *Tokenizer) map[string]bool {
+	for _, word := range words {
+		for _, token := range t.Tokens(word) {
+			if set == nil {
+				set = map[string]bool{}
+			}
+			set[token] = true
+		}
+	}
+	return set
+}
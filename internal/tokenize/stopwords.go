@@ -0,0 +1,60 @@
+package tokenize
+
+// StopWords are the built-in stop-word lists, by language code.
+var StopWords = map[string][]string{
+	"en": {
+		"a", "about", "above", "after", "again", "against", "all", "am", "an",
+		"and", "any", "are", "as", "at", "be", "because", "been", "before",
+		"being", "below", "between", "both", "but", "by", "can", "could", "did",
+		"do", "does", "doing", "down", "during", "each", "few", "for", "from",
+		"further", "had", "has", "have", "having", "he", "her", "here", "hers",
+		"herself", "him", "himself", "his", "how", "i", "if", "in", "into", "is",
+		"it", "its", "itself", "just", "me", "more", "most", "my", "myself", "no",
+		"nor", "not", "now", "of", "off", "on", "once", "only", "or", "other",
+		"our", "ours", "ourselves", "out", "over", "own", "same", "she", "should",
+		"so", "some", "such", "than", "that", "the", "their", "theirs", "them",
+		"themselves", "then", "there", "these", "they", "this", "those",
+		"through", "to", "too", "under", "until", "up", "very", "was", "we",
+		"were", "what", "when", "where", "which", "while", "who", "whom", "why",
+		"will", "with", "would", "you", "your", "yours", "yourself",
+		"yourselves",
+	},
+	"de": {
+		"aber", "alle", "als", "also", "am", "an", "auch", "auf", "aus", "bei",
+		"bin", "bis", "bist", "da", "damit", "dann", "das", "dass", "dein",
+		"dem", "den", "der", "des", "dich", "die", "dir", "doch", "du", "durch",
+		"ein", "eine", "einem", "einen", "einer", "eines", "er", "es", "euch",
+		"euer", "für", "hat", "hatte", "ich", "ihr", "ihre", "im", "in", "ist",
+		"ja", "kann", "kein", "keine", "man", "mein", "mich", "mir", "mit",
+		"nach", "nicht", "noch", "nun", "nur", "ob", "oder", "ohne", "sein",
+		"sich", "sie", "sind", "so", "über", "um", "und", "uns", "unser",
+		"unter", "vom", "von", "vor", "war", "waren", "was", "weil", "wenn",
+		"wer", "wie", "wir", "wird", "zu", "zum", "zur",
+	},
+	"fr": {
+		"à", "au", "aux", "avec", "ce", "ces", "cette", "dans", "de", "des",
+		"du", "elle", "elles", "en", "est", "et", "eux", "il", "ils", "je", "la",
+		"le", "les", "leur", "leurs", "lui", "ma", "mais", "me", "même", "mes",
+		"moi", "mon", "ne", "nos", "notre", "nous", "on", "ou", "où", "par",
+		"pas", "pour", "qu", "que", "qui", "sa", "se", "ses", "son", "sont",
+		"sur", "ta", "te", "tes", "toi", "ton", "tu", "un", "une", "vos",
+		"votre", "vous", "y",
+	},
+	"es": {
+		"a", "al", "algo", "como", "con", "de", "del", "el", "ella", "ellas",
+		"ellos", "en", "entre", "era", "es", "esta", "este", "esto", "fue",
+		"ha", "hay", "la", "las", "le", "les", "lo", "los", "me", "mi", "mis",
+		"muy", "más", "ni", "no", "nos", "o", "para", "pero", "por", "que",
+		"qué", "se", "ser", "si", "sin", "sobre", "su", "sus", "también", "te",
+		"tu", "un", "una", "uno", "y", "ya", "yo",
+	},
+	"it": {
+		"a", "ad", "al", "alla", "alle", "anche", "che", "chi", "ci", "come",
+		"con", "da", "dal", "dalla", "dei", "del", "della", "delle", "di", "e",
+		"è", "ed", "gli", "ha", "hanno", "i", "il", "in", "io", "la", "le",
+		"lei", "lo", "loro", "lui", "ma", "mi", "ne", "nei", "nel", "nella",
+		"non", "noi", "o", "per", "più", "quella", "quello", "questa", "questo",
+		"se", "si", "sono", "su", "sua", "suo", "tra", "tu", "un", "una", "uno",
+		"voi",
+	},
+}
@@ -0,0 +1,253 @@
+// Package tokenize splits text into the tokens (words) counted and indexed by
+// the jobs.
+//
+// A Tokenizer runs a list of steps on the text, such as Unicode normalization
+// and case folding, and then splits it with a Segmenter. Each request picks
+// its tokenizer with the following parameters:
+//
+//	tokenizer    simple (default) or unicode
+//	case         lower (default for simple), fold (default for unicode) or keep
+//	normalize    none (default), nfc or nfkc
+//	accents      keep (default) or strip
+//	apostrophes  keep (default) or split, for the unicode tokenizer
+//	hyphens      keep (default) or split, for the unicode tokenizer
+//
+// A Filter then drops stop words, or keeps only a given vocabulary.
+package tokenize
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A Step transforms the text before it is segmented.
+type Step func(text string) string
+
+// NFC composes the text in Unicode normalization form C.
+func NFC(text string) string { return norm.NFC.String(text) }
+
+// NFKC composes the text in Unicode normalization form KC, which also
+// replaces compatibility characters such as ligatures and full-width letters.
+func NFKC(text string) string { return norm.NFKC.String(text) }
+
+// StripAccents removes the diacritical marks from the letters of the text.
+func StripAccents(text string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	stripped, _, err := transform.String(t, text)
+	if err != nil {
+		return text
+	}
+	return stripped
+}
+
+// Fold applies Unicode case folding, so that for example "Straße" and
+// "STRASSE" give the same token.
+func Fold(text string) string { return cases.Fold().String(text) }
+
+// Lower converts the text to lower case.
+func Lower(text string) string { return strings.ToLower(text) }
+
+// A Segmenter splits text in tokens.
+type Segmenter interface {
+	Segment(text string) []string
+}
+
+var punctuation = regexp.MustCompile(`[[:punct:]]`)
+
+// Simple removes ASCII punctuation and splits the text at white space.
+type Simple struct{}
+
+func (Simple) Segment(text string) []string {
+	return strings.Fields(punctuation.ReplaceAllString(text, ""))
+}
+
+// Words splits the text at the word boundaries of Unicode Standard Annex #29
+// and keeps the words that hold letters, marks or digits. By these rules, Han
+// and Hiragana characters, which are written without spaces, are each a
+// token of their own, while a run of Katakana is one token. Thai, Lao, Khmer
+// and Myanmar need a dictionary to find their words, so each of their runs
+// between spaces or punctuation is one token. Apostrophes within a word and
+// hyphens between two words are kept in the word, as "'" and "-", unless they
+// are set to split it.
+type Words struct {
+	SplitApostrophes bool
+	SplitHyphens     bool
+}
+
+func (s Words) Segment(text string) []string {
+
+	tokens := []string{}
+	// joinable is whether the last token can be joined by a hyphen or a run
+	// of a dictionary script
+	joinable, hyphen, dictionary := false, false, false
+
+	state := -1
+	for len(text) > 0 {
+		var segment string
+		segment, text, state = uniseg.FirstWordInString(text, state)
+
+		switch {
+		case isDictionaryWord(segment):
+			if dictionary {
+				tokens[len(tokens)-1] += segment
+			} else {
+				tokens = append(tokens, segment)
+			}
+			joinable, hyphen, dictionary = false, false, true
+			continue
+		case !strings.ContainsFunc(segment, isWordRune):
+			hyphen = joinable && !hyphen && !s.SplitHyphens && isHyphenSegment(segment)
+			joinable, dictionary = hyphen, false
+			continue
+		}
+
+		words := s.apostrophes(segment)
+		if hyphen && !isIdeographic(segment) {
+			tokens[len(tokens)-1] += "-" + words[0]
+			words = words[1:]
+		}
+		tokens = append(tokens, words...)
+		joinable, hyphen, dictionary = !isIdeographic(segment), false, false
+	}
+
+	return tokens
+}
+
+// apostrophes returns the word with its apostrophes written as "'", or its
+// parts between the apostrophes if they split it.
+func (s Words) apostrophes(word string) []string {
+	if !strings.ContainsFunc(word, isApostrophe) {
+		return []string{word}
+	}
+	if s.SplitApostrophes {
+		return strings.FieldsFunc(word, isApostrophe)
+	}
+	return []string{strings.Map(func(r rune) rune {
+		if isApostrophe(r) {
+			return '\''
+		}
+		return r
+	}, word)}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.In(r, unicode.L, unicode.M, unicode.N)
+}
+
+// isIdeographic reports whether the segment is a Han or Hiragana character,
+// which is not joined to the next word by a hyphen.
+func isIdeographic(segment string) bool {
+	r, _ := utf8.DecodeRuneInString(segment)
+	return unicode.In(r, unicode.Han, unicode.Hiragana)
+}
+
+// isDictionaryWord reports whether the segment is in a script whose words
+// can only be found with a dictionary.
+func isDictionaryWord(segment string) bool {
+	r, _ := utf8.DecodeRuneInString(segment)
+	return unicode.In(r, unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar)
+}
+
+func isHyphenSegment(segment string) bool {
+	r, size := utf8.DecodeRuneInString(segment)
+	return size == len(segment) && isHyphen(r)
+}
+
+func isApostrophe(r rune) bool {
+	switch r {
+	case '\'', '’', 'ʼ':
+		return true
+	}
+	return false
+}
+
+func isHyphen(r rune) bool {
+	switch r {
+	case '-', '‐', '‑':
+		return true
+	}
+	return false
+}
+
+// Tokenizer runs its steps on a text and then segments it.
+type Tokenizer struct {
+	Steps     []Step
+	Segmenter Segmenter
+}
+
+// Tokens returns the tokens of the text.
+func (t *Tokenizer) Tokens(text string) []string {
+	for _, step := range t.Steps {
+		text = step(text)
+	}
+	return t.Segmenter.Segment(text)
+}
+
+// FromParams returns the tokenizer chosen by the request parameters.
+func FromParams(params url.Values) (*Tokenizer, error) {
+
+	t := &Tokenizer{}
+	caseStep := Lower
+
+	switch v := params.Get("tokenizer"); v {
+	case "", "simple":
+		t.Segmenter = Simple{}
+	case "unicode":
+		split := map[string]bool{}
+		for _, name := range []string{"apostrophes", "hyphens"} {
+			switch v := params.Get(name); v {
+			case "", "keep":
+			case "split":
+				split[name] = true
+			default:
+				return nil, fmt.Errorf("invalid %s parameter: %q", name, v)
+			}
+		}
+		t.Segmenter = Words{SplitApostrophes: split["apostrophes"], SplitHyphens: split["hyphens"]}
+		caseStep = Fold
+	default:
+		return nil, fmt.Errorf("invalid tokenizer parameter: %q", v)
+	}
+
+	switch v := params.Get("normalize"); v {
+	case "", "none":
+	case "nfc":
+		t.Steps = append(t.Steps, NFC)
+	case "nfkc":
+		t.Steps = append(t.Steps, NFKC)
+	default:
+		return nil, fmt.Errorf("invalid normalize parameter: %q", v)
+	}
+
+	switch v := params.Get("accents"); v {
+	case "", "keep":
+	case "strip":
+		t.Steps = append(t.Steps, StripAccents)
+	default:
+		return nil, fmt.Errorf("invalid accents parameter: %q", v)
+	}
+
+	switch v := params.Get("case"); v {
+	case "":
+		t.Steps = append(t.Steps, caseStep)
+	case "lower":
+		t.Steps = append(t.Steps, Lower)
+	case "fold":
+		t.Steps = append(t.Steps, Fold)
+	case "keep":
+	default:
+		return nil, fmt.Errorf("invalid case parameter: %q", v)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,235 @@
+package tokenize
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Words_Segment(t *testing.T) {
+	tests := []struct {
+		name      string
+		segmenter Words
+		text      string
+		want      []string
+	}{
+		{
+			name: "test punctuation",
+			text: "“Lorem”, ipsum—dolor… sit!",
+			want: []string{"Lorem", "ipsum", "dolor", "sit"},
+		},
+		{
+			name: "test accented letters",
+			text: "naïve café",
+			want: []string{"naïve", "café"},
+		},
+		{
+			name: "test keep apostrophes and hyphens",
+			text: "don’t re-use 'quoted' - alone",
+			want: []string{"don't", "re-use", "quoted", "alone"},
+		},
+		{
+			name:      "test split apostrophes and hyphens",
+			segmenter: Words{SplitApostrophes: true, SplitHyphens: true},
+			text:      "don't re-use",
+			want:      []string{"don", "t", "re", "use"},
+		},
+		{
+			name: "test ideographs",
+			text: "東京に行く Tokyo",
+			want: []string{"東", "京", "に", "行", "く", "Tokyo"},
+		},
+		{
+			name: "test katakana",
+			text: "カタカナ語です",
+			want: []string{"カタカナ", "語", "で", "す"},
+		},
+		{
+			name: "test dictionary scripts",
+			text: "ภาษาไทย ง่าย, Thai",
+			want: []string{"ภาษาไทย", "ง่าย", "Thai"},
+		},
+		{
+			name: "test hyphens between words only",
+			text: "re--use well- known -ly 東-京",
+			want: []string{"re", "use", "well", "known", "ly", "東", "京"},
+		},
+		{
+			name: "test word boundaries",
+			text: "e.g. 3.14 foo_bar donʼt",
+			want: []string{"e.g", "3.14", "foo_bar", "don't"},
+		},
+		{
+			name: "test digits",
+			text: "42 x86-64",
+			want: []string{"42", "x86-64"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.segmenter.Segment(tt.text))
+		})
+	}
+}
+
+func Test_FromParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  url.Values
+		text    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "test simple tokenizer",
+			text: "Don't, Straße!",
+			want: []string{"dont", "straße"},
+		},
+		{
+			name:   "test unicode tokenizer",
+			params: url.Values{"tokenizer": {"unicode"}},
+			text:   "Don't, Straße!",
+			want:   []string{"don't", "strasse"},
+		},
+		{
+			name:   "test keep case",
+			params: url.Values{"tokenizer": {"unicode"}, "case": {"keep"}},
+			text:   "Don't, Straße!",
+			want:   []string{"Don't", "Straße"},
+		},
+		{
+			name:   "test nfkc normalization",
+			params: url.Values{"tokenizer": {"unicode"}, "normalize": {"nfkc"}},
+			text:   "ﬁne ＡＢＣ",
+			want:   []string{"fine", "abc"},
+		},
+		{
+			name:   "test nfc normalization",
+			params: url.Values{"tokenizer": {"unicode"}, "normalize": {"nfc"}},
+			text:   "café café",
+			want:   []string{"café", "café"},
+		},
+		{
+			name:   "test strip accents",
+			params: url.Values{"tokenizer": {"unicode"}, "accents": {"strip"}},
+			text:   "Naïve café",
+			want:   []string{"naive", "cafe"},
+		},
+		{
+			name:   "test split hyphens",
+			params: url.Values{"tokenizer": {"unicode"}, "hyphens": {"split"}},
+			text:   "re-use don't",
+			want:   []string{"re", "use", "don't"},
+		},
+		{
+			name:    "test invalid tokenizer",
+			params:  url.Values{"tokenizer": {"bpe"}},
+			wantErr: `invalid tokenizer parameter: "bpe"`,
+		},
+		{
+			name:    "test invalid apostrophes",
+			params:  url.Values{"tokenizer": {"unicode"}, "apostrophes": {"drop"}},
+			wantErr: `invalid apostrophes parameter: "drop"`,
+		},
+		{
+			name:    "test invalid normalization",
+			params:  url.Values{"normalize": {"nfd"}},
+			wantErr: `invalid normalize parameter: "nfd"`,
+		},
+		{
+			name:    "test invalid accents",
+			params:  url.Values{"accents": {"remove"}},
+			wantErr: `invalid accents parameter: "remove"`,
+		},
+		{
+			name:    "test invalid case",
+			params:  url.Values{"case": {"upper"}},
+			wantErr: `invalid case parameter: "upper"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenizer, err := FromParams(tt.params)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, tokenizer.Tokens(tt.text))
+		})
+	}
+}
+
+func Test_FilterFromParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  url.Values
+		text    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "test no filter",
+			text: "the cat and the hat",
+			want: []string{"the", "cat", "and", "the", "hat"},
+		},
+		{
+			name:   "test built-in stop words",
+			params: url.Values{"stopwords": {"en"}},
+			text:   "The cat and the hat",
+			want:   []string{"cat", "hat"},
+		},
+		{
+			name:   "test several languages",
+			params: url.Values{"stopwords": {"en, de"}},
+			text:   "the Katze und der Hut",
+			want:   []string{"katze", "hut"},
+		},
+		{
+			name:   "test inline stop words",
+			params: url.Values{"stopwords": {"en"}, "exclude": {"Cat,hat"}},
+			text:   "the cat and the hat sat",
+			want:   []string{"sat"},
+		},
+		{
+			name:   "test vocabulary",
+			params: url.Values{"vocabulary": {"cat,Hat"}},
+			text:   "the cat and the hat sat",
+			want:   []string{"cat", "hat"},
+		},
+		{
+			name:   "test stop words go through the tokenizer",
+			params: url.Values{"tokenizer": {"unicode"}, "exclude": {"DON’T"}},
+			text:   "don't stop",
+			want:   []string{"stop"},
+		},
+		{
+			name:    "test unknown list",
+			params:  url.Values{"stopwords": {"xx"}},
+			wantErr: `unknown stop-word list: "xx"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenizer, err := FromParams(tt.params)
+			if !assert.NoError(t, err) {
+				return
+			}
+			filter, err := FilterFromParams(tt.params, tokenizer)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			got := []string{}
+			for _, token := range tokenizer.Tokens(tt.text) {
+				if filter.Keep(token) {
+					got = append(got, token)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Package tracing sets up the OpenTelemetry tracing of the services and
+// carries the W3C trace context across them.
+//
+// The coordinator starts a trace per job, and the workers continue it from
+// the headers of the HTTP requests or the metadata of the gRPC calls.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Name is the instrumentation name of the spans of the services.
+const Name = "github.com/FDeRubeis/mapreduce"
+
+// exporters of the spans
+const (
+	None   = "none"
+	OTLP   = "otlp"
+	Stdout = "stdout"
+)
+
+// Config is the configuration of the tracing of a service.
+type Config struct {
+	// Exporter is OTLP, Stdout or None.
+	Exporter string
+}
+
+// Register registers the setting of the tracing, otel-traces-exporter,
+// whose environment variable is the standard OTEL_TRACES_EXPORTER.
+func (c *Config) Register(s *config.Set) {
+	s.EnumVar(&c.Exporter, "otel-traces-exporter", None, []string{None, OTLP, Stdout}, "exporter of the spans")
+}
+
+// Setup installs the global tracer provider of the service, with the
+// exporter of the configuration. The OTLP exporter is configured with the
+// standard OTEL_EXPORTER_OTLP_* variables. The W3C trace context is
+// propagated in any case. The returned function flushes the spans, and must
+// be called on shutdown.
+func Setup(ctx context.Context, service string, c Config) (func(context.Context) error, error) {
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch c.Exporter {
+	case "", None:
+		return func(context.Context) error { return nil }, nil
+	case OTLP:
+		exporter, err = otlptracegrpc.New(ctx)
+	case Stdout:
+		exporter, err = stdouttrace.New()
+	default:
+		return nil, fmt.Errorf("invalid exporter: %s", c.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", service)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span of the services.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(Name).Start(ctx, name, opts...)
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// InjectHTTP adds the trace context of ctx to the headers of a request.
+func InjectHTTP(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// OutgoingGRPC adds the trace context of ctx to the metadata of the gRPC
+// calls made with the returned context.
+func OutgoingGRPC(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// Handler continues the trace of the requests to h in a server span.
+func Handler(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= 400 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// statusRecorder records the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// StreamInterceptor continues the trace of the gRPC calls in a server span
+// named after the method.
+func StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+	md, _ := metadata.FromIncomingContext(ss.Context())
+	ctx := otel.GetTextMapPropagator().Extract(ss.Context(), metadataCarrier(md))
+	ctx, span := Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer))
+
+	err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	End(span, err)
+	return err
+}
+
+// serverStream is a server stream with the context of its span.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// metadataCarrier carries the trace context in gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
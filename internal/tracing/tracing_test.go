@@ -0,0 +1,144 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// recordSpans installs a tracer provider that records the spans in memory
+// for the duration of the test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	return exporter
+}
+
+func Test_Setup(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		wantErr  string
+	}{
+		{name: "test no exporter"},
+		{name: "test disabled exporter", exporter: None},
+		{name: "test stdout exporter", exporter: Stdout},
+		{name: "test invalid exporter", exporter: "zipkin", wantErr: "invalid exporter: zipkin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+			defer func() {
+				otel.SetTracerProvider(provider)
+				otel.SetTextMapPropagator(propagator)
+			}()
+
+			shutdown, err := Setup(context.Background(), "test", Config{Exporter: tt.exporter})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.NoError(t, shutdown(context.Background()))
+			}
+		})
+	}
+}
+
+func Test_Config(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+
+	var c Config
+	settings := config.New("test")
+	c.Register(settings)
+	assert.EqualError(t, settings.Load(nil), "invalid OTEL_TRACES_EXPORTER: zipkin: must be one of none, otlp, stdout")
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp")
+	assert.NoError(t, settings.Load(nil))
+	assert.Equal(t, OTLP, c.Exporter)
+}
+
+func Test_Handler(t *testing.T) {
+	exporter := recordSpans(t)
+
+	h := Handler("map task", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid job", http.StatusBadRequest)
+	}))
+
+	ctx, parent := Start(context.Background(), "map task")
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	InjectHTTP(ctx, r.Header)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	server := spans[0]
+	assert.Equal(t, parent.SpanContext().TraceID(), server.SpanContext.TraceID())
+	assert.Equal(t, parent.SpanContext().SpanID(), server.Parent.SpanID())
+	assert.Equal(t, codes.Error, server.Status.Code)
+}
+
+func Test_StreamInterceptor(t *testing.T) {
+	exporter := recordSpans(t)
+
+	// the outgoing metadata of the client is the incoming metadata of the
+	// server
+	ctx, parent := Start(context.Background(), "reduce task")
+	md, _ := metadata.FromOutgoingContext(OutgoingGRPC(ctx))
+	stream := &fakeStream{ctx: metadata.NewIncomingContext(context.Background(), md)}
+
+	var handlerCtx context.Context
+	err := StreamInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/mapreduce.Reducer/Reduce"}, func(srv any, ss grpc.ServerStream) error {
+		handlerCtx = ss.Context()
+		return errors.New("invalid job")
+	})
+	parent.End()
+	assert.EqualError(t, err, "invalid job")
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	server := spans[0]
+	assert.Equal(t, "/mapreduce.Reducer/Reduce", server.Name)
+	assert.Equal(t, parent.SpanContext().TraceID(), server.SpanContext.TraceID())
+	assert.Equal(t, parent.SpanContext().SpanID(), server.Parent.SpanID())
+	assert.Equal(t, codes.Error, server.Status.Code)
+	assert.Equal(t, server.SpanContext.SpanID(), spanID(handlerCtx))
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+// spanID returns the ID of the span of ctx.
+func spanID(ctx context.Context) trace.SpanID {
+	return trace.SpanContextFromContext(ctx).SpanID()
+}
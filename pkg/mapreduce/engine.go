@@ -0,0 +1,727 @@
+package mapreduce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/job"
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/internal/metrics"
+	"github.com/FDeRubeis/mapreduce/internal/partition"
+	"github.com/FDeRubeis/mapreduce/internal/tracing"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultTaskBytes is the default size of a map task of a streamed input.
+const DefaultTaskBytes = 1 << 20
+
+// DefaultMaxInflightBytes is the default cap on the bytes of the map tasks
+// that have not finished yet.
+const DefaultMaxInflightBytes = 64 << 20
+
+// Engine runs jobs. The zero value runs the tasks in process, with as many
+// shuffle and reduce tasks as CPUs, and does not retry failed tasks.
+type Engine struct {
+	// Transport runs the tasks. If nil, they run in process.
+	Transport Transport
+	// Partitioner assigns the mappings to the shuffle tasks. If nil,
+	// HashPartitioner is used.
+	Partitioner Partitioner
+	// Params are the parameters of the job, as the query parameters of a
+	// request to the coordinator.
+	Params url.Values
+
+	// MapTasks, if set, makes the map phase read the input whole and split
+	// it in MapTasks tasks with the same number of lines. Otherwise, the
+	// input is streamed in tasks of up to TaskBytes, each dispatched as
+	// soon as it is read.
+	MapTasks int
+	// TaskBytes is the size of a map task of a streamed input. If 0,
+	// DefaultTaskBytes is used.
+	TaskBytes int
+	// MaxInflightBytes caps the bytes of the map tasks that have not
+	// finished yet: reading the input pauses while they are reached. If 0,
+	// DefaultMaxInflightBytes is used.
+	MaxInflightBytes int
+	// SpillDir, if set, is the directory where the mappings of each shuffle
+	// task are written as the map tasks finish, to be read back when the
+	// shuffle task runs. Otherwise, they are kept in memory until then.
+	SpillDir string
+
+	// ShuffleTasks and ReduceTasks are the number of tasks of the shuffle
+	// and reduce phases. If 0, the number of CPUs is used.
+	ShuffleTasks int
+	ReduceTasks  int
+	// Workers is the number of tasks of a phase that run at the same time.
+	// If 0, all the tasks run at the same time.
+	Workers int
+
+	Retry RetryPolicy
+	// Skew spreads the hot keys among the shuffle tasks.
+	Skew SkewPolicy
+	// ReduceInShuffle makes the shuffle tasks also reduce their groups, if
+	// the Transport is a ShuffleReducer, so that only the final values come
+	// back. The reduce phase then has no tasks, ShuffleTimeout limits the
+	// reduction and Skew is ignored: each key must be reduced in one task.
+	ReduceInShuffle bool
+	// Progress, if set, receives the progress of the phases.
+	Progress Progress
+	// JobID, if set, identifies the run of the job in the logs of the
+	// engine and of the workers.
+	JobID string
+
+	// Timeout limits the whole job and MapTimeout, ShuffleTimeout and
+	// ReduceTimeout each of its phases. If 0, there is no limit. When a
+	// deadline passes, the outstanding tasks are canceled and the error of
+	// the job wraps context.DeadlineExceeded.
+	Timeout        time.Duration
+	MapTimeout     time.Duration
+	ShuffleTimeout time.Duration
+	ReduceTimeout  time.Duration
+}
+
+// Run runs the job on the input with the zero Engine.
+func Run(ctx context.Context, j *Job, input io.Reader) (map[string]json.RawMessage, error) {
+	return (&Engine{}).Run(ctx, j, input)
+}
+
+// Run runs the map, shuffle and reduce phases of the job on the input and
+// returns the final value of each key. If the parameters ask for the top K
+// keys, only those are returned.
+func (e *Engine) Run(ctx context.Context, j *Job, input io.Reader) (map[string]json.RawMessage, error) {
+	start := time.Now()
+	if e.JobID != "" {
+		ctx = logging.WithFields(ctx, log.Fields{logging.JobField: e.JobID})
+	}
+	ctx, span := tracing.Start(ctx, "job", trace.WithAttributes(attribute.String("mapreduce.job", j.Name)))
+	result, err := e.run(ctx, j, input)
+	tracing.End(span, err)
+	metrics.Jobs.WithLabelValues(j.Name, metrics.Status(err)).Inc()
+	metrics.JobDuration.WithLabelValues(j.Name).Observe(time.Since(start).Seconds())
+	return result, err
+}
+
+func (e *Engine) run(ctx context.Context, j *Job, input io.Reader) (map[string]json.RawMessage, error) {
+
+	params := url.Values{}
+	for key, values := range e.Params {
+		params[key] = values
+	}
+	params.Set("job", j.Name)
+
+	top, err := j.ParseTopK(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, e.Timeout, fmt.Errorf("job timed out after %s: %w", e.Timeout, context.DeadlineExceeded))
+		defer cancel()
+	}
+
+	mapped, err := e.newMapOutput()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := mapped.remove(); err != nil {
+			logging.FromContext(ctx).Errorf("Error removing the spilled mappings: %s", err)
+		}
+	}()
+
+	// map
+	phaseCtx, phase := e.startPhase(ctx, MapPhase, e.MapTimeout)
+	err = e.mapInput(phaseCtx, j, input, params, mapped)
+	e.finish(phase, err)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Mappings.Add(float64(mapped.total))
+
+	if reducer, ok := e.shuffleReducer(); ok {
+		return e.shuffleReduce(ctx, j, reducer, mapped, params, top)
+	}
+
+	// shuffle
+	phaseCtx, phase = e.startPhase(ctx, ShufflePhase, e.ShuffleTimeout)
+	shuffles, err := e.shuffle(phaseCtx, j, mapped, params)
+	e.finish(phase, err)
+	if err != nil {
+		return nil, err
+	}
+	metrics.DistinctKeys.Observe(float64(len(shuffles)))
+
+	// reduce
+	phaseCtx, phase = e.startPhase(ctx, ReducePhase, e.ReduceTimeout)
+	result, err := e.reduce(phaseCtx, j, shuffles, params)
+	if err == nil && top != nil {
+		// merge the top K of each reduce task
+		result, err = top.Select(result)
+	}
+	e.finish(phase, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// shuffleReducer returns the transport if the shuffle tasks reduce their
+// groups.
+func (e *Engine) shuffleReducer() (ShuffleReducer, bool) {
+	if !e.ReduceInShuffle {
+		return nil, false
+	}
+	reducer, ok := e.transport().(ShuffleReducer)
+	return reducer, ok
+}
+
+// shuffleReduce runs the shuffle phase with the shuffle tasks reducing their
+// groups, and a reduce phase with no tasks.
+func (e *Engine) shuffleReduce(ctx context.Context, j *Job, reducer ShuffleReducer, mapped *mapOutput, params url.Values, top *job.TopK) (map[string]json.RawMessage, error) {
+
+	phaseCtx, phase := e.startPhase(ctx, ShufflePhase, e.ShuffleTimeout)
+	shuffleTasks, err := e.partitionShuffle(phaseCtx, mapped)
+	if err != nil {
+		e.finish(phase, err)
+		return nil, err
+	}
+	tasks := e.newTaskGroup(phaseCtx)
+	result := map[string]json.RawMessage{}
+
+	for i := range shuffleTasks.parts() {
+		tasks.run(func() error {
+
+			// skip empty tasks
+			if shuffleTasks.len(i) == 0 {
+				e.taskDone(ShufflePhase)
+				return nil
+			}
+			mappings, err := shuffleTasks.read(i)
+			if err != nil {
+				return err
+			}
+
+			task := Task{Job: j, JobID: e.JobID, Phase: ShufflePhase, Index: i, Params: params}
+			var taskResult map[string]json.RawMessage
+			err = e.Retry.run(tasks.ctx, ShufflePhase, i, func(attempt int) (err error) {
+				task.Attempt = attempt
+				ctx, span := startTask(tasks.ctx, task)
+				defer func() { tracing.End(span, err) }()
+				taskResult, err = reducer.ShuffleReduce(ctx, task, mappings)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			tasks.mu.Lock()
+			defer tasks.mu.Unlock()
+			for key, value := range taskResult {
+				result[key] = value
+			}
+			e.taskDone(ShufflePhase)
+			return nil
+		})
+	}
+
+	err = tasks.wait()
+	e.finish(phase, err)
+	if err != nil {
+		return nil, err
+	}
+	metrics.DistinctKeys.Observe(float64(len(result)))
+
+	// the shuffle tasks have reduced the groups
+	_, phase = e.startPhase(ctx, ReducePhase, e.ReduceTimeout)
+	e.start(ReducePhase, 0)
+	if top != nil {
+		result, err = top.Select(result)
+	}
+	e.finish(phase, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// phaseRun is a running phase of a job.
+type phaseRun struct {
+	phase  Phase
+	start  time.Time
+	span   trace.Span
+	cancel context.CancelFunc
+}
+
+// startPhase returns the context of a phase, with its timeout if any, and
+// starts its span. The phase must be ended with finish.
+func (e *Engine) startPhase(ctx context.Context, phase Phase, timeout time.Duration) (context.Context, *phaseRun) {
+
+	p := &phaseRun{phase: phase, start: time.Now()}
+	ctx, p.span = tracing.Start(ctx, string(phase))
+
+	if timeout == 0 {
+		ctx, p.cancel = context.WithCancel(ctx)
+	} else {
+		ctx, p.cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%s phase timed out after %s: %w", phase, timeout, context.DeadlineExceeded))
+	}
+	return ctx, p
+}
+
+// startTask starts the span of an attempt of a task.
+func startTask(ctx context.Context, task Task) (context.Context, trace.Span) {
+	return tracing.Start(ctx, string(task.Phase)+" task", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.Int("mapreduce.task.index", task.Index),
+		attribute.Int("mapreduce.task.attempt", task.Attempt),
+	))
+}
+
+// mapOutput collects the mappings of the map tasks, assigned to the shuffle
+// tasks by the partitioner, and samples their keys if hot keys are spread.
+type mapOutput struct {
+	partitions
+	partitioner Partitioner
+	// total is the number of mappings.
+	total int
+	// sampler is nil if the keys are not sampled.
+	sampler *partition.Sampler
+}
+
+// newMapOutput returns the map output of a job, with a part for each shuffle
+// task.
+func (e *Engine) newMapOutput() (*mapOutput, error) {
+	parts, err := newPartitions(e.SpillDir, e.shuffleTasks())
+	if err != nil {
+		return nil, err
+	}
+	partitioner := e.Partitioner
+	if partitioner == nil {
+		partitioner = HashPartitioner
+	}
+	return &mapOutput{partitions: parts, partitioner: partitioner, sampler: e.newSampler()}, nil
+}
+
+// add adds the mappings of a map task to their parts.
+func (o *mapOutput) add(mappings []KV) error {
+	n := o.parts()
+	parts := make([][]KV, n)
+	for _, mapping := range mappings {
+		part := o.partitioner.Partition(mapping.Key, n)
+		parts[part] = append(parts[part], mapping)
+		if o.sampler != nil {
+			o.sampler.Add(mapping.Key)
+		}
+	}
+	for part, mappings := range parts {
+		if err := o.partitions.add(part, mappings); err != nil {
+			return err
+		}
+	}
+	o.total += len(mappings)
+	return nil
+}
+
+// mapInput runs the map phase on the input, streamed or split in lines, and
+// adds the mappings to mapped.
+func (e *Engine) mapInput(ctx context.Context, j *Job, input io.Reader, params url.Values, mapped *mapOutput) error {
+
+	if e.MapTasks == 0 {
+		return e.mapStream(ctx, j, input, params, mapped)
+	}
+
+	content, err := io.ReadAll(input)
+	if err != nil {
+		return fmt.Errorf("reading input: %w", err)
+	}
+
+	mapTasks := partition.Lines(string(content), e.MapTasks, job.TaskSeparator(params))
+	e.start(MapPhase, len(mapTasks))
+	tasks := e.newTaskGroup(ctx)
+
+	for i, content := range mapTasks {
+		tasks.run(func() error {
+			return e.mapTask(tasks, Task{Job: j, JobID: e.JobID, Phase: MapPhase, Index: i, Params: params}, content, mapped)
+		})
+	}
+
+	return tasks.wait()
+}
+
+// mapStream reads the input and dispatches each map task as soon as it is
+// cut, while the rest of the input is still being read. Reading pauses while
+// MaxInflightBytes are waiting to be mapped.
+func (e *Engine) mapStream(ctx context.Context, j *Job, input io.Reader, params url.Values, mapped *mapOutput) error {
+
+	e.start(MapPhase, 0)
+	budget := newByteBudget(orDefault(e.MaxInflightBytes, DefaultMaxInflightBytes))
+	splitter := partition.NewSplitter(input, orDefault(e.TaskBytes, DefaultTaskBytes), job.TaskSeparator(params))
+	tasks := e.newTaskGroup(ctx)
+
+	for i := 0; tasks.ctx.Err() == nil; i++ {
+
+		content, err := splitter.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			tasks.fail(fmt.Errorf("reading input: %w", err))
+			break
+		}
+
+		budget.acquire(len(content))
+		e.addTask(MapPhase)
+
+		tasks.run(func() error {
+			defer budget.release(len(content))
+			return e.mapTask(tasks, Task{Job: j, JobID: e.JobID, Phase: MapPhase, Index: i, Params: params}, content, mapped)
+		})
+	}
+
+	return tasks.wait()
+}
+
+// mapTask runs a map task of the group and adds its mappings to mapped.
+func (e *Engine) mapTask(tasks *taskGroup, task Task, content string, mapped *mapOutput) error {
+
+	var taskMappings []KV
+	err := e.Retry.run(tasks.ctx, MapPhase, task.Index, func(attempt int) (err error) {
+		task.Attempt = attempt
+		ctx, span := startTask(tasks.ctx, task)
+		defer func() { tracing.End(span, err) }()
+		taskMappings, err = e.transport().Map(ctx, task, content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	tasks.mu.Lock()
+	defer tasks.mu.Unlock()
+	if err := mapped.add(taskMappings); err != nil {
+		return err
+	}
+	e.taskDone(MapPhase)
+	return nil
+}
+
+// newSampler returns the sampler of the keys of a job, or nil if no key can
+// be hot.
+func (e *Engine) newSampler() *partition.Sampler {
+	if _, ok := e.shuffleReducer(); ok {
+		return nil
+	}
+	return e.Skew.newSampler()
+}
+
+// shuffleTasks returns the number of shuffle tasks.
+func (e *Engine) shuffleTasks() int {
+	return orDefault(e.ShuffleTasks, runtime.NumCPU())
+}
+
+// partitionShuffle starts the shuffle phase and returns the mappings of its
+// tasks: the parts of the partitioner, with the hot keys spread among
+// several tasks. The hot keys move to new parts, which mapped then holds.
+func (e *Engine) partitionShuffle(ctx context.Context, mapped *mapOutput) (partitions, error) {
+
+	shufflers := mapped.parts()
+	e.start(ShufflePhase, shufflers)
+
+	hot := e.Skew.hotKeys(mapped.sampler, shufflers)
+	if len(hot.next) > 0 {
+		metrics.HotKeys.Add(float64(len(hot.next)))
+		logging.FromContext(ctx).Infof("Spreading %d hot keys among %d shuffle tasks", len(hot.next), hot.splits)
+		spread, err := newPartitions(e.SpillDir, shufflers)
+		if err != nil {
+			return nil, err
+		}
+		if err := hot.spread(mapped.partitions, spread); err != nil {
+			spread.remove()
+			return nil, err
+		}
+		mapped.partitions.remove()
+		mapped.partitions = spread
+	}
+
+	for i := range shufflers {
+		metrics.ShufflePartitionSize.Observe(float64(mapped.len(i)))
+	}
+	return mapped.partitions, nil
+}
+
+// shuffle groups the mappings by key in the tasks of partitionShuffle.
+func (e *Engine) shuffle(ctx context.Context, j *Job, mapped *mapOutput, params url.Values) (map[string][]json.RawMessage, error) {
+
+	shuffleTasks, err := e.partitionShuffle(ctx, mapped)
+	if err != nil {
+		return nil, err
+	}
+	tasks := e.newTaskGroup(ctx)
+	shuffles := map[string][]json.RawMessage{}
+
+	for i := range shuffleTasks.parts() {
+		tasks.run(func() error {
+
+			// skip empty tasks
+			if shuffleTasks.len(i) == 0 {
+				e.taskDone(ShufflePhase)
+				return nil
+			}
+			mappings, err := shuffleTasks.read(i)
+			if err != nil {
+				return err
+			}
+
+			task := Task{Job: j, JobID: e.JobID, Phase: ShufflePhase, Index: i, Params: params}
+			var taskShuffles map[string][]json.RawMessage
+			err = e.Retry.run(tasks.ctx, ShufflePhase, i, func(attempt int) (err error) {
+				task.Attempt = attempt
+				ctx, span := startTask(tasks.ctx, task)
+				defer func() { tracing.End(span, err) }()
+				taskShuffles, err = e.transport().Shuffle(ctx, task, mappings)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			tasks.mu.Lock()
+			defer tasks.mu.Unlock()
+			// the groups of a hot key come from several tasks
+			for key, values := range taskShuffles {
+				shuffles[key] = append(shuffles[key], values...)
+			}
+			e.taskDone(ShufflePhase)
+			return nil
+		})
+	}
+
+	if err := tasks.wait(); err != nil {
+		return nil, err
+	}
+	return shuffles, nil
+}
+
+// reduce computes the final values of the groups, split in ReduceTasks tasks.
+func (e *Engine) reduce(ctx context.Context, j *Job, shuffles map[string][]json.RawMessage, params url.Values) (map[string]json.RawMessage, error) {
+
+	reduceTasks := partition.Groups(shuffles, orDefault(e.ReduceTasks, runtime.NumCPU()))
+	e.start(ReducePhase, len(reduceTasks))
+	if skew, ok := valueSkew(reduceTasks); ok {
+		metrics.ReduceSkew.Observe(skew)
+	}
+
+	tasks := e.newTaskGroup(ctx)
+	result := map[string]json.RawMessage{}
+
+	for i, groups := range reduceTasks {
+		tasks.run(func() error {
+
+			// skip empty tasks
+			if len(groups) == 0 {
+				e.taskDone(ReducePhase)
+				return nil
+			}
+
+			task := Task{Job: j, JobID: e.JobID, Phase: ReducePhase, Index: i, Params: params}
+			var taskResult map[string]json.RawMessage
+			err := e.Retry.run(tasks.ctx, ReducePhase, i, func(attempt int) (err error) {
+				task.Attempt = attempt
+				ctx, span := startTask(tasks.ctx, task)
+				defer func() { tracing.End(span, err) }()
+				taskResult, err = e.transport().Reduce(ctx, task, groups)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			tasks.mu.Lock()
+			defer tasks.mu.Unlock()
+			for key, value := range taskResult {
+				result[key] = value
+			}
+			e.taskDone(ReducePhase)
+			return nil
+		})
+	}
+
+	if err := tasks.wait(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e *Engine) transport() Transport {
+	if e.Transport == nil {
+		return Local{}
+	}
+	return e.Transport
+}
+
+func (e *Engine) start(phase Phase, tasks int) {
+	if e.Progress != nil {
+		e.Progress.PhaseStarted(phase, tasks)
+	}
+}
+
+func (e *Engine) addTask(phase Phase) {
+	if e.Progress != nil {
+		e.Progress.TaskAdded(phase)
+	}
+}
+
+func (e *Engine) taskDone(phase Phase) {
+	if e.Progress != nil {
+		e.Progress.TaskDone(phase)
+	}
+}
+
+// finish ends a phase started with startPhase.
+func (e *Engine) finish(p *phaseRun, err error) {
+	p.cancel()
+	tracing.End(p.span, err)
+	metrics.PhaseDuration.WithLabelValues(string(p.phase), metrics.Status(err)).Observe(time.Since(p.start).Seconds())
+	if e.Progress != nil {
+		e.Progress.PhaseFinished(p.phase, err)
+	}
+}
+
+// valueSkew returns the values of the largest task over the mean values of
+// the tasks. ok is false if there are no values.
+func valueSkew(tasks []map[string][]json.RawMessage) (skew float64, ok bool) {
+	total, largest := 0, 0
+	for _, groups := range tasks {
+		values := 0
+		for _, group := range groups {
+			values += len(group)
+		}
+		total += values
+		largest = max(largest, values)
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return float64(largest) * float64(len(tasks)) / float64(total), true
+}
+
+func orDefault(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	return n
+}
+
+// taskGroup runs the tasks of a phase, up to Workers at the same time. The
+// first task to fail cancels the others. mu protects the results of the
+// tasks.
+type taskGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	sem    chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (e *Engine) newTaskGroup(ctx context.Context) *taskGroup {
+	ctx, cancel := context.WithCancel(ctx)
+	g := &taskGroup{ctx: ctx, cancel: cancel}
+	if e.Workers > 0 {
+		g.sem = make(chan struct{}, e.Workers)
+	}
+	return g
+}
+
+// run starts a task, once a worker is free.
+func (g *taskGroup) run(task func() error) {
+
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.ctx.Done():
+			return
+		}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+		if err := task(); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// fail records the error of the group, unless one was recorded already, and
+// cancels the running tasks.
+func (g *taskGroup) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err == nil {
+		g.err = err
+		g.cancel()
+	}
+}
+
+// wait waits for the tasks to finish and returns the first error. If the
+// parent context is done, its error is returned.
+func (g *taskGroup) wait() error {
+	g.wg.Wait()
+	defer g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return g.err
+	}
+	return context.Cause(g.ctx)
+}
+
+// byteBudget limits the number of bytes in flight. acquire blocks until the
+// requested bytes are available; requests larger than the whole budget wait
+// for the budget to be empty.
+type byteBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	max   int
+	inUse int
+}
+
+func newByteBudget(max int) *byteBudget {
+	b := &byteBudget{max: max}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *byteBudget) acquire(n int) {
+	n = min(n, b.max)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.inUse+n > b.max {
+		b.cond.Wait()
+	}
+	b.inUse += n
+}
+
+func (b *byteBudget) release(n int) {
+	n = min(n, b.max)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inUse -= n
+	b.cond.Broadcast()
+}
@@ -0,0 +1,637 @@
+package mapreduce
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var one = json.RawMessage("1")
+
+var wordCount = map[string]json.RawMessage{
+	"lorem": json.RawMessage("3"),
+	"ipsum": json.RawMessage("2"),
+	"sit":   json.RawMessage("1"),
+}
+
+func Test_Engine_Run(t *testing.T) {
+
+	content := "lorem lorem\nlorem ipsum\nipsum sit"
+
+	tests := []struct {
+		name    string
+		job     string
+		engine  Engine
+		want    map[string]json.RawMessage
+		wantErr string
+	}{
+		{
+			name:   "test zero engine",
+			engine: Engine{},
+			want:   wordCount,
+		},
+		{
+			name:   "test streamed input",
+			engine: Engine{TaskBytes: 11, MaxInflightBytes: 12, ShuffleTasks: 3, ReduceTasks: 2, Workers: 2},
+			want:   wordCount,
+		},
+		{
+			name:   "test split in lines",
+			engine: Engine{MapTasks: 3, ShuffleTasks: 2, ReduceTasks: 3},
+			want:   wordCount,
+		},
+		{
+			name:   "test combiner",
+			engine: Engine{TaskBytes: 11, Params: url.Values{"combine": {"true"}}},
+			want:   wordCount,
+		},
+		{
+			name:   "test top k",
+			engine: Engine{TaskBytes: 11, ReduceTasks: 3, Params: url.Values{"top": {"2"}}},
+			want: map[string]json.RawMessage{
+				"lorem": json.RawMessage("3"),
+				"ipsum": json.RawMessage("2"),
+			},
+		},
+		{
+			name:   "test reduce in shuffle",
+			engine: Engine{TaskBytes: 11, ShuffleTasks: 2, ReduceInShuffle: true},
+			want:   wordCount,
+		},
+		{
+			name:   "test reduce in shuffle top k",
+			engine: Engine{TaskBytes: 11, ShuffleTasks: 3, ReduceInShuffle: true, Params: url.Values{"top": {"1"}}},
+			want: map[string]json.RawMessage{
+				"lorem": json.RawMessage("3"),
+			},
+		},
+		{
+			name:   "test other job",
+			job:    "grep",
+			engine: Engine{TaskBytes: 11, Params: url.Values{"pattern": {"sit"}}},
+			want: map[string]json.RawMessage{
+				"ipsum sit": one,
+			},
+		},
+		{
+			name:    "test invalid parameter",
+			engine:  Engine{TaskBytes: 11, Workers: 1, Params: url.Values{"tokenizer": {"gibberish"}}},
+			wantErr: `map task 0 failed: invalid tokenizer parameter: "gibberish"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := Lookup(tt.job)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			got, err := tt.engine.Run(context.Background(), j, strings.NewReader(content))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_Engine_RunSentences(t *testing.T) {
+
+	// the sentences span lines, and the n-grams of a sentence cross them
+	content := "lorem ipsum dolor\nsit. amet consectetur\n\nadipiscing\nelit sed\ndo eiusmod\ntempor."
+	params := url.Values{"ngrams": {"2"}, "boundary": {"sentence"}}
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+	want, err := j.Map(content, params)
+	if !assert.NoError(t, err) {
+		return
+	}
+	wantCounts := map[string]json.RawMessage{}
+	for _, mapping := range want {
+		wantCounts[mapping.Key] = one
+	}
+
+	tests := []struct {
+		name   string
+		engine Engine
+	}{
+		{
+			name:   "test streamed input cut at paragraphs",
+			engine: Engine{TaskBytes: 60, ShuffleTasks: 2},
+		},
+		{
+			name:   "test split in paragraphs",
+			engine: Engine{MapTasks: 2, ShuffleTasks: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.engine.Params = params
+			got, err := tt.engine.Run(context.Background(), j, strings.NewReader(content))
+			if assert.NoError(t, err) {
+				assert.Equal(t, wantCounts, got)
+			}
+		})
+	}
+}
+
+func Test_Engine_RunInput(t *testing.T) {
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("test broken upload", func(t *testing.T) {
+		input := io.MultiReader(strings.NewReader("lorem lorem\n"), iotest.ErrReader(io.ErrUnexpectedEOF))
+		_, err := (&Engine{TaskBytes: 11}).Run(context.Background(), j, input)
+		assert.EqualError(t, err, "reading input: unexpected EOF")
+	})
+
+	t.Run("test canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := (&Engine{}).Run(ctx, j, strings.NewReader("lorem ipsum"))
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// blockingTransport runs the tasks in process, except the tasks of one phase,
+// which block until they are canceled.
+type blockingTransport struct {
+	Local
+	phase Phase
+	// canceled counts the blocked tasks that were canceled
+	canceled *atomic.Int32
+}
+
+func (t blockingTransport) block(ctx context.Context, task Task) error {
+	if task.Phase != t.phase {
+		return nil
+	}
+	<-ctx.Done()
+	t.canceled.Add(1)
+	return ctx.Err()
+}
+
+func (t blockingTransport) Map(ctx context.Context, task Task, content string) ([]KV, error) {
+	if err := t.block(ctx, task); err != nil {
+		return nil, err
+	}
+	return t.Local.Map(ctx, task, content)
+}
+
+func (t blockingTransport) Shuffle(ctx context.Context, task Task, mappings []KV) (map[string][]json.RawMessage, error) {
+	if err := t.block(ctx, task); err != nil {
+		return nil, err
+	}
+	return t.Local.Shuffle(ctx, task, mappings)
+}
+
+func (t blockingTransport) Reduce(ctx context.Context, task Task, groups map[string][]json.RawMessage) (map[string]json.RawMessage, error) {
+	if err := t.block(ctx, task); err != nil {
+		return nil, err
+	}
+	return t.Local.Reduce(ctx, task, groups)
+}
+
+func Test_Engine_RunTimeout(t *testing.T) {
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		name    string
+		engine  Engine
+		phase   Phase
+		wantErr string
+	}{
+		{
+			name:    "test map timeout",
+			engine:  Engine{MapTimeout: 10 * time.Millisecond},
+			phase:   MapPhase,
+			wantErr: "map phase timed out after 10ms: context deadline exceeded",
+		},
+		{
+			name:    "test shuffle timeout",
+			engine:  Engine{MapTimeout: time.Hour, ShuffleTimeout: 10 * time.Millisecond},
+			phase:   ShufflePhase,
+			wantErr: "shuffle phase timed out after 10ms: context deadline exceeded",
+		},
+		{
+			name:    "test reduce timeout",
+			engine:  Engine{ReduceTimeout: 10 * time.Millisecond},
+			phase:   ReducePhase,
+			wantErr: "reduce phase timed out after 10ms: context deadline exceeded",
+		},
+		{
+			name:    "test job timeout",
+			engine:  Engine{Timeout: 10 * time.Millisecond, ReduceTimeout: time.Hour},
+			phase:   ReducePhase,
+			wantErr: "job timed out after 10ms: context deadline exceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canceled := &atomic.Int32{}
+			engine := tt.engine
+			engine.Transport = blockingTransport{phase: tt.phase, canceled: canceled}
+			engine.TaskBytes = 11
+			engine.ShuffleTasks = 2
+			engine.ReduceTasks = 2
+
+			_, err := engine.Run(context.Background(), j, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit"))
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.ErrorContains(t, err, tt.wantErr)
+
+			// all the blocked tasks were canceled
+			wantCanceled := map[Phase]int32{MapPhase: 3, ShufflePhase: 2, ReducePhase: 2}[tt.phase]
+			assert.Equal(t, wantCanceled, canceled.Load())
+		})
+	}
+}
+
+func Test_Engine_RunCanceled(t *testing.T) {
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// cancel the job while its map tasks are running, as a client that goes
+	// away would
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := &atomic.Int32{}
+	engine := &Engine{TaskBytes: 11, Transport: blockingTransport{phase: MapPhase, canceled: canceled}}
+	progress := &progressRecorder{started: map[Phase]int{}, added: map[Phase]int{}, done: map[Phase]int{}}
+	engine.Progress = progress
+
+	go func() {
+		for {
+			progress.mu.Lock()
+			added := progress.added[MapPhase]
+			progress.mu.Unlock()
+			if added == 3 {
+				cancel()
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	_, err = engine.Run(ctx, j, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit"))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int32(3), canceled.Load())
+}
+
+// progressRecorder records the progress of a job.
+type progressRecorder struct {
+	mu       sync.Mutex
+	started  map[Phase]int
+	added    map[Phase]int
+	done     map[Phase]int
+	finished []Phase
+}
+
+func (p *progressRecorder) PhaseStarted(phase Phase, tasks int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started[phase] = tasks
+}
+
+func (p *progressRecorder) TaskAdded(phase Phase) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.added[phase]++
+}
+
+func (p *progressRecorder) TaskDone(phase Phase) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done[phase]++
+}
+
+func (p *progressRecorder) PhaseFinished(phase Phase, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished = append(p.finished, phase)
+}
+
+func Test_Engine_Progress(t *testing.T) {
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	progress := &progressRecorder{started: map[Phase]int{}, added: map[Phase]int{}, done: map[Phase]int{}}
+	engine := &Engine{TaskBytes: 11, ShuffleTasks: 2, ReduceTasks: 4, Progress: progress}
+	_, err = engine.Run(context.Background(), j, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, map[Phase]int{MapPhase: 0, ShufflePhase: 2, ReducePhase: 4}, progress.started)
+	assert.Equal(t, map[Phase]int{MapPhase: 3}, progress.added)
+	assert.Equal(t, map[Phase]int{MapPhase: 3, ShufflePhase: 2, ReducePhase: 4}, progress.done)
+	assert.Equal(t, []Phase{MapPhase, ShufflePhase, ReducePhase}, progress.finished)
+}
+
+func Test_Engine_RunReduceInShuffle(t *testing.T) {
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		name        string
+		transport   Transport
+		wantStarted map[Phase]int
+		wantDone    map[Phase]int
+	}{
+		{
+			name:        "test shuffle reducer",
+			transport:   Local{},
+			wantStarted: map[Phase]int{MapPhase: 0, ShufflePhase: 2, ReducePhase: 0},
+			wantDone:    map[Phase]int{MapPhase: 3, ShufflePhase: 2},
+		},
+		{
+			// the embedded interface hides ShuffleReduce
+			name:        "test transport without shuffle reducer",
+			transport:   struct{ Transport }{Local{}},
+			wantStarted: map[Phase]int{MapPhase: 0, ShufflePhase: 2, ReducePhase: 4},
+			wantDone:    map[Phase]int{MapPhase: 3, ShufflePhase: 2, ReducePhase: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := &progressRecorder{started: map[Phase]int{}, added: map[Phase]int{}, done: map[Phase]int{}}
+			engine := &Engine{
+				Transport:       tt.transport,
+				TaskBytes:       11,
+				ShuffleTasks:    2,
+				ReduceTasks:     4,
+				ReduceInShuffle: true,
+				Skew:            SkewPolicy{HotShare: 0.1, SampleRate: 1},
+				Progress:        progress,
+			}
+
+			got, err := engine.Run(context.Background(), j, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, wordCount, got)
+			assert.Equal(t, tt.wantStarted, progress.started)
+			assert.Equal(t, tt.wantDone, progress.done)
+			assert.Equal(t, []Phase{MapPhase, ShufflePhase, ReducePhase}, progress.finished)
+		})
+	}
+}
+
+func Test_Engine_RunMetrics(t *testing.T) {
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+	content := "lorem lorem\nlorem ipsum\nipsum sit"
+
+	tests := []struct {
+		name         string
+		engine       Engine
+		wantStatus   string
+		wantMapTasks float64
+		wantFailures float64
+		wantMappings float64
+	}{
+		{
+			name:         "test successful job",
+			engine:       Engine{TaskBytes: 11},
+			wantStatus:   metrics.Succeeded,
+			wantMapTasks: 3,
+			wantMappings: 6,
+		},
+		{
+			name:         "test failed job",
+			engine:       Engine{TaskBytes: 11, Workers: 1, Params: url.Values{"tokenizer": {"gibberish"}}},
+			wantStatus:   metrics.Failed,
+			wantMapTasks: 1,
+			wantFailures: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := metrics.Jobs.WithLabelValues(j.Name, tt.wantStatus)
+			mapTasks := metrics.Tasks.WithLabelValues(string(MapPhase), tt.wantStatus)
+			failures := metrics.TaskAttemptFailures.WithLabelValues(string(MapPhase))
+			before := []float64{testutil.ToFloat64(jobs), testutil.ToFloat64(mapTasks), testutil.ToFloat64(failures), testutil.ToFloat64(metrics.Mappings)}
+
+			tt.engine.Run(context.Background(), j, strings.NewReader(content))
+
+			assert.Equal(t, 1.0, testutil.ToFloat64(jobs)-before[0])
+			assert.Equal(t, tt.wantMapTasks, testutil.ToFloat64(mapTasks)-before[1])
+			assert.Equal(t, tt.wantFailures, testutil.ToFloat64(failures)-before[2])
+			assert.Equal(t, tt.wantMappings, testutil.ToFloat64(metrics.Mappings)-before[3])
+		})
+	}
+}
+
+// shuffleRecorder runs the tasks in process and records the shuffle tasks
+// that got each key.
+type shuffleRecorder struct {
+	Local
+	mu    sync.Mutex
+	tasks map[string]map[int]bool
+}
+
+func (r *shuffleRecorder) Shuffle(ctx context.Context, task Task, mappings []KV) (map[string][]json.RawMessage, error) {
+	r.mu.Lock()
+	for _, mapping := range mappings {
+		if r.tasks[mapping.Key] == nil {
+			r.tasks[mapping.Key] = map[int]bool{}
+		}
+		r.tasks[mapping.Key][task.Index] = true
+	}
+	r.mu.Unlock()
+	return r.Local.Shuffle(ctx, task, mappings)
+}
+
+func Test_Engine_RunSkew(t *testing.T) {
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// "the" is half of the words
+	content := strings.Repeat("the lorem the ipsum the dolor the sit\n", 100)
+	want := map[string]json.RawMessage{
+		"the":   json.RawMessage("400"),
+		"lorem": json.RawMessage("100"),
+		"ipsum": json.RawMessage("100"),
+		"dolor": json.RawMessage("100"),
+		"sit":   json.RawMessage("100"),
+	}
+
+	tests := []struct {
+		name      string
+		skew      SkewPolicy
+		wantTasks int
+	}{
+		{name: "test hot keys not spread", wantTasks: 1},
+		{name: "test hot key spread", skew: SkewPolicy{HotShare: 0.3, SampleRate: 4}, wantTasks: 4},
+		{name: "test hot key spread among some tasks", skew: SkewPolicy{HotShare: 0.3, SampleRate: 4, Splits: 2}, wantTasks: 2},
+		{name: "test no hot key", skew: SkewPolicy{HotShare: 0.6, SampleRate: 4}, wantTasks: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &shuffleRecorder{tasks: map[string]map[int]bool{}}
+			engine := Engine{Transport: recorder, TaskBytes: 64, ShuffleTasks: 4, ReduceTasks: 2, Skew: tt.skew}
+
+			got, err := engine.Run(context.Background(), j, strings.NewReader(content))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, want, got)
+			assert.Len(t, recorder.tasks["the"], tt.wantTasks)
+			assert.Len(t, recorder.tasks["lorem"], 1)
+		})
+	}
+}
+
+// spillRecorder runs the tasks in process and records the bytes spilled to
+// dir when the shuffle tasks run.
+type spillRecorder struct {
+	Local
+	dir     string
+	mu      sync.Mutex
+	spilled int64
+}
+
+func (r *spillRecorder) Shuffle(ctx context.Context, task Task, mappings []KV) (map[string][]json.RawMessage, error) {
+	files, _ := os.ReadDir(r.dir)
+	r.mu.Lock()
+	for _, file := range files {
+		if info, err := file.Info(); err == nil {
+			r.spilled = max(r.spilled, info.Size())
+		}
+	}
+	r.mu.Unlock()
+	return r.Local.Shuffle(ctx, task, mappings)
+}
+
+func Test_Engine_RunSpill(t *testing.T) {
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+	content := strings.Repeat("the lorem the ipsum the dolor the sit\n", 100)
+
+	tests := []struct {
+		name string
+		skew SkewPolicy
+	}{
+		{name: "test spilled mappings"},
+		{name: "test spilled mappings with hot keys", skew: SkewPolicy{HotShare: 0.3, SampleRate: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			recorder := &spillRecorder{dir: dir}
+			engine := Engine{Transport: recorder, TaskBytes: 64, ShuffleTasks: 4, ReduceTasks: 2, Skew: tt.skew, SpillDir: dir}
+
+			got, err := engine.Run(context.Background(), j, strings.NewReader(content))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, json.RawMessage("400"), got["the"])
+			assert.Equal(t, json.RawMessage("100"), got["sit"])
+
+			// the mappings were on disk during the shuffle, and are removed
+			assert.Positive(t, recorder.spilled)
+			files, _ := os.ReadDir(dir)
+			assert.Empty(t, files)
+		})
+	}
+}
+
+func Test_valueSkew(t *testing.T) {
+	tests := []struct {
+		name     string
+		tasks    []map[string][]json.RawMessage
+		wantSkew float64
+		wantOk   bool
+	}{
+		{
+			name:  "test no values",
+			tasks: []map[string][]json.RawMessage{{}, {}},
+		},
+		{
+			name:     "test balanced tasks",
+			tasks:    []map[string][]json.RawMessage{{"lorem": {one, one}}, {"ipsum": {one}, "sit": {one}}},
+			wantSkew: 1,
+			wantOk:   true,
+		},
+		{
+			name:     "test hot key",
+			tasks:    []map[string][]json.RawMessage{{"lorem": {one, one, one}}, {"ipsum": {one}}, {}},
+			wantSkew: 2.25,
+			wantOk:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skew, ok := valueSkew(tt.tasks)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.wantSkew, skew)
+		})
+	}
+}
+
+func Test_byteBudget(t *testing.T) {
+
+	b := newByteBudget(10)
+	b.acquire(6)
+
+	acquired := make(chan struct{})
+	go func() {
+		b.acquire(6)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired more bytes than the budget")
+	default:
+	}
+
+	b.release(6)
+	<-acquired
+
+	// requests larger than the budget wait for it to be empty
+	b.release(6)
+	b.acquire(100)
+	b.release(100)
+}
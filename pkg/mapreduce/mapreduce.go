@@ -0,0 +1,161 @@
+// Package mapreduce runs MapReduce jobs. It is the engine behind the map,
+// shuffle, reduce and coordinator services, and it can be embedded in any Go
+// program:
+//
+//	j, _ := mapreduce.Lookup("wordcount")
+//	result, err := mapreduce.Run(ctx, j, strings.NewReader("row, row, row your boat"))
+//
+// By default the tasks of a job run in process. An Engine with a Transport
+// sends them to the map, shuffle and reduce services instead, over HTTP or
+// gRPC, and the Partitioner of the Engine decides which shuffle task gets
+// each key.
+package mapreduce
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sync"
+
+	"github.com/FDeRubeis/mapreduce/internal/job"
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/internal/partition"
+	log "github.com/sirupsen/logrus"
+)
+
+// KV is a key/value record, such as a mapping of a map task.
+type KV = kv.KV
+
+// Job is a MapReduce computation: its map, optional combine and reduce
+// functions.
+type Job = job.Job
+
+// Register makes a job available by name to Lookup and to the services. It
+// panics if the job is incomplete or if a job with the same name is already
+// registered.
+func Register(j *Job) {
+	job.Register(j)
+}
+
+// Lookup returns the job registered with the given name. An empty name
+// selects the word count.
+func Lookup(name string) (*Job, error) {
+	return job.Lookup(name)
+}
+
+// Phase is a phase of a job.
+type Phase string
+
+// phases of a job, in the order they run
+const (
+	MapPhase     Phase = "map"
+	ShufflePhase Phase = "shuffle"
+	ReducePhase  Phase = "reduce"
+)
+
+// Task identifies a task of a job for a Transport.
+type Task struct {
+	Job *Job
+	// JobID identifies the run of the job in the logs, if set.
+	JobID string
+	Phase Phase
+	// Index is the number of the task in its phase.
+	Index int
+	// Attempt is the number of the current attempt of the task, starting
+	// from 0, so that retries can reach a different worker.
+	Attempt int
+	// Params are the parameters of the job, as the query parameters of a
+	// request to the coordinator. They include the name of the job.
+	Params url.Values
+}
+
+// ID identifies the task in the logs. It is the same for all its attempts.
+func (t Task) ID() string {
+	return logging.TaskID(string(t.Phase), t.Index)
+}
+
+// Transport runs the tasks of a job. Errors wrapped by Permanent are not
+// retried.
+type Transport interface {
+	Map(ctx context.Context, task Task, content string) ([]KV, error)
+	Shuffle(ctx context.Context, task Task, mappings []KV) (map[string][]json.RawMessage, error)
+	Reduce(ctx context.Context, task Task, groups map[string][]json.RawMessage) (map[string]json.RawMessage, error)
+}
+
+// ShuffleReducer is a Transport whose shuffle workers can also reduce the
+// groups of their task, so that the groups are not sent back to the
+// coordinator and out again to the reduce workers. All the mappings of a key
+// must go to the same task.
+type ShuffleReducer interface {
+	ShuffleReduce(ctx context.Context, task Task, mappings []KV) (map[string]json.RawMessage, error)
+}
+
+// Partitioner assigns each key to one of n shuffle tasks. All the mappings
+// of a key must go to the same task.
+type Partitioner interface {
+	Partition(key string, n int) int
+}
+
+// PartitionerFunc adapts a function to the Partitioner interface.
+type PartitionerFunc func(key string, n int) int
+
+func (f PartitionerFunc) Partition(key string, n int) int {
+	return f(key, n)
+}
+
+// HashPartitioner assigns the keys by their FNV-1a hash modulo n. When n
+// changes, almost all the keys move to a different task.
+var HashPartitioner Partitioner = PartitionerFunc(partition.Key)
+
+// RendezvousPartitioner assigns the keys to the shuffle workers by
+// rendezvous hashing of their names, where shuffle task i goes to the worker
+// named workers[i]. When a worker is added or removed, only the keys that it
+// gains or loses move. If n is not the number of workers, the keys are
+// assigned as by HashPartitioner, with a warning, since they then move
+// whenever n changes.
+func RendezvousPartitioner(workers []string) Partitioner {
+	r := partition.NewRendezvous(workers)
+	var warn sync.Once
+	return PartitionerFunc(func(key string, n int) int {
+		if n != len(workers) {
+			warn.Do(func() {
+				log.Warnf("Assigning the keys to %d shuffle tasks by hash: the rendezvous partitioner has %d workers", n, len(workers))
+			})
+			return partition.Key(key, n)
+		}
+		return r.Node(key)
+	})
+}
+
+// Progress receives the progress of the phases of a job. Its methods can be
+// called concurrently.
+type Progress interface {
+	// PhaseStarted is called when a phase starts with the given number of
+	// tasks. The map phase of a streamed input starts with no tasks and
+	// adds them as the input is read.
+	PhaseStarted(phase Phase, tasks int)
+	TaskAdded(phase Phase)
+	TaskDone(phase Phase)
+	PhaseFinished(phase Phase, err error)
+}
+
+// permanentError is a task failure that retrying would not fix, such as a
+// request rejected by the worker.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a task failure that retrying would not fix, so that the
+// task is not attempted again.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
@@ -0,0 +1,36 @@
+package mapreduce
+
+import (
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/partition"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RendezvousPartitioner(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	workers := []string{"shuffle-0", "shuffle-1", "shuffle-2"}
+	p := RendezvousPartitioner(workers)
+	keys := []string{"lorem", "ipsum", "dolor", "sit", "amet"}
+
+	// the keys go to their rendezvous worker
+	r := partition.NewRendezvous(workers)
+	for _, key := range keys {
+		assert.Equal(t, r.Node(key), p.Partition(key, 3), key)
+	}
+	assert.Empty(t, hook.AllEntries())
+
+	// with another number of tasks they are assigned by hash, with a single
+	// warning
+	for _, key := range keys {
+		assert.Equal(t, HashPartitioner.Partition(key, 4), p.Partition(key, 4), key)
+	}
+	if assert.Len(t, hook.AllEntries(), 1) {
+		assert.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+		assert.Equal(t, "Assigning the keys to 4 shuffle tasks by hash: the rendezvous partitioner has 3 workers", hook.LastEntry().Message)
+	}
+}
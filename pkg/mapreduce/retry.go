@@ -0,0 +1,78 @@
+package mapreduce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/internal/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy defines how many times a task is attempted and how long to wait
+// between attempts. The wait doubles after each failed attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a task. Tasks are attempted
+	// at least once.
+	MaxAttempts int
+	// Backoff is the wait before the first retry.
+	Backoff time.Duration
+}
+
+// DefaultRetryPolicy attempts a task 3 times, waiting 100ms before the first
+// retry.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: 100 * time.Millisecond}
+
+// run calls attempt until it succeeds, it fails with a permanent error, the
+// attempts are exhausted or the context is done. attempt receives the number
+// of the current attempt, starting from 0, so that it can pick a different
+// worker on each retry.
+func (p RetryPolicy) run(ctx context.Context, phase Phase, task int, attempt func(n int) error) (err error) {
+
+	defer func() {
+		metrics.Tasks.WithLabelValues(string(phase), metrics.Status(err)).Inc()
+	}()
+
+	maxAttempts := max(p.MaxAttempts, 1)
+
+	for n := 0; n < maxAttempts; n++ {
+
+		if n > 0 {
+			select {
+			case <-time.After(p.Backoff << (n - 1)):
+			case <-ctx.Done():
+				return fmt.Errorf("%s task %d failed: %w", phase, task, context.Cause(ctx))
+			}
+		}
+
+		if err = attempt(n); err == nil {
+			return nil
+		}
+		metrics.TaskAttemptFailures.WithLabelValues(string(phase)).Inc()
+
+		// a canceled task is not retried
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s task %d failed: %w", phase, task, context.Cause(ctx))
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return fmt.Errorf("%s task %d failed: %w", phase, task, err)
+		}
+
+		entry := logging.FromContext(ctx).WithFields(log.Fields{
+			logging.TaskField:    logging.TaskID(string(phase), task),
+			logging.PhaseField:   string(phase),
+			logging.AttemptField: n,
+		})
+		var werr *workerError
+		if errors.As(err, &werr) {
+			entry = entry.WithField(logging.WorkerField, werr.worker)
+		}
+		entry.Warnf("Attempt %d of %s task %d failed: %s", n+1, phase, task, err)
+	}
+
+	return fmt.Errorf("%s task %d failed after %d attempts: %w", phase, task, maxAttempts, err)
+}
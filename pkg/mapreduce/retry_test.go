@@ -0,0 +1,84 @@
+package mapreduce
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RetryPolicy_run(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		failure      error
+		wantAttempts int
+		wantErr      string
+	}{
+		{
+			name:         "test success at first attempt",
+			failures:     0,
+			wantAttempts: 1,
+		},
+		{
+			name:         "test success after retries",
+			failures:     2,
+			failure:      errors.New("connection refused"),
+			wantAttempts: 3,
+		},
+		{
+			name:         "test attempts exhausted",
+			failures:     3,
+			failure:      errors.New("connection refused"),
+			wantAttempts: 3,
+			wantErr:      "map task 4 failed after 3 attempts: connection refused",
+		},
+		{
+			name:         "test permanent error",
+			failures:     3,
+			failure:      Permanent(errors.New("worker answered 400 Bad Request")),
+			wantAttempts: 1,
+			wantErr:      "map task 4 failed: worker answered 400 Bad Request",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := RetryPolicy{MaxAttempts: 3}
+
+			attempts := 0
+			err := policy.run(context.Background(), MapPhase, 4, func(n int) error {
+				assert.Equal(t, attempts, n)
+				attempts++
+				if attempts <= tt.failures {
+					return tt.failure
+				}
+				return nil
+			})
+
+			if tt.wantErr != "" {
+				assert.EqualErrorf(t, err, tt.wantErr, "run() = %v, want %q", err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equalf(t, tt.wantAttempts, attempts, "run() made %d attempts, want %d", attempts, tt.wantAttempts)
+		})
+	}
+}
+
+func Test_RetryPolicy_runCanceled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}
+
+	attempts := 0
+	err := policy.run(ctx, ReducePhase, 1, func(n int) error {
+		attempts++
+		cancel()
+		return errors.New("connection refused")
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, attempts)
+}
@@ -0,0 +1,93 @@
+package mapreduce
+
+import (
+	"github.com/FDeRubeis/mapreduce/internal/partition"
+)
+
+// DefaultSampleRate is the default number of mappings per sampled mapping.
+const DefaultSampleRate = 100
+
+// SkewPolicy spreads the hot keys of a job, which make up a large share of
+// its mappings, among several shuffle tasks, so that no shuffle task gets
+// most of the mappings. The groups of a hot key are merged before the reduce
+// phase, which reduces each key in a single task. The zero value spreads no
+// key.
+type SkewPolicy struct {
+	// HotShare is the share of the mappings above which a key is hot, such
+	// as 0.1. If 0, no key is hot.
+	HotShare float64
+	// SampleRate is the number of mappings per sampled mapping: the shares
+	// of the keys are estimated from a sample of the mappings, taken as the
+	// map tasks finish. If 0, DefaultSampleRate is used.
+	SampleRate int
+	// Splits is the number of shuffle tasks a hot key is spread among. If
+	// 0, all the shuffle tasks are used.
+	Splits int
+}
+
+// newSampler returns the sampler of the keys of a job, or nil if no key can
+// be hot.
+func (p SkewPolicy) newSampler() *partition.Sampler {
+	if p.HotShare <= 0 {
+		return nil
+	}
+	return partition.NewSampler(orDefault(p.SampleRate, DefaultSampleRate))
+}
+
+// hotKeys assigns the mappings of the hot keys to the shuffle tasks in turn,
+// starting from the task of the partitioner.
+type hotKeys struct {
+	// next is the turn of each hot key.
+	next   map[string]int
+	splits int
+	tasks  int
+}
+
+// hotKeys returns the assignment of the hot keys found by the sampler among
+// the shuffle tasks.
+func (p SkewPolicy) hotKeys(sampler *partition.Sampler, tasks int) *hotKeys {
+	h := &hotKeys{next: map[string]int{}, splits: tasks, tasks: tasks}
+	if p.Splits > 0 {
+		h.splits = min(p.Splits, tasks)
+	}
+	if sampler == nil || h.splits < 2 {
+		return h
+	}
+	for key := range sampler.Hot(p.HotShare) {
+		h.next[key] = 0
+	}
+	return h
+}
+
+// task returns the shuffle task of a mapping of the key, which the
+// partitioner assigns to shfl.
+func (h *hotKeys) task(key string, shfl int) int {
+	turn, ok := h.next[key]
+	if !ok {
+		return shfl
+	}
+	h.next[key] = (turn + 1) % h.splits
+	return (shfl + turn) % h.tasks
+}
+
+// spread moves the mappings of src to the parts of dst given by task, one part
+// of src at a time.
+func (h *hotKeys) spread(src, dst partitions) error {
+	for part := range src.parts() {
+		mappings, err := src.read(part)
+		if err != nil {
+			return err
+		}
+		tasks := make([][]KV, dst.parts())
+		for _, mapping := range mappings {
+			shfl := h.task(mapping.Key, part)
+			tasks[shfl] = append(tasks[shfl], mapping)
+		}
+		for shfl, mappings := range tasks {
+			if err := dst.add(shfl, mappings); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package mapreduce
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// partitions keeps the mappings of each shuffle task from the map tasks that
+// produce them to the shuffle task that reads them.
+type partitions interface {
+	// parts returns the number of parts.
+	parts() int
+	// add appends mappings to a part.
+	add(part int, mappings []KV) error
+	// read returns the mappings of a part, in the order they were added.
+	read(part int) ([]KV, error)
+	// len returns the number of mappings of a part.
+	len(part int) int
+	// remove discards the mappings of all the parts.
+	remove() error
+}
+
+// newPartitions returns n parts kept in memory, or spilled to files in dir
+// if it is set.
+func newPartitions(dir string, n int) (partitions, error) {
+	if dir == "" {
+		return &memoryPartitions{mappings: make([][]KV, n)}, nil
+	}
+	return newSpillPartitions(dir, n)
+}
+
+// memoryPartitions keeps the mappings in memory.
+type memoryPartitions struct {
+	mappings [][]KV
+}
+
+func (m *memoryPartitions) parts() int {
+	return len(m.mappings)
+}
+
+func (m *memoryPartitions) add(part int, mappings []KV) error {
+	m.mappings[part] = append(m.mappings[part], mappings...)
+	return nil
+}
+
+func (m *memoryPartitions) read(part int) ([]KV, error) {
+	return m.mappings[part], nil
+}
+
+func (m *memoryPartitions) len(part int) int {
+	return len(m.mappings[part])
+}
+
+func (m *memoryPartitions) remove() error {
+	m.mappings = nil
+	return nil
+}
+
+// spillPartitions writes the mappings of each part to its own file, one JSON
+// record per line, so that they take no memory until they are read.
+type spillPartitions struct {
+	files   []*os.File
+	writers []*bufio.Writer
+	counts  []int
+}
+
+func newSpillPartitions(dir string, n int) (*spillPartitions, error) {
+	s := &spillPartitions{
+		files:   make([]*os.File, 0, n),
+		writers: make([]*bufio.Writer, 0, n),
+		counts:  make([]int, n),
+	}
+	for range n {
+		f, err := os.CreateTemp(dir, "mapreduce-spill-*")
+		if err != nil {
+			s.remove()
+			return nil, fmt.Errorf("creating spill file: %w", err)
+		}
+		s.files = append(s.files, f)
+		s.writers = append(s.writers, bufio.NewWriter(f))
+	}
+	return s, nil
+}
+
+func (s *spillPartitions) parts() int {
+	return len(s.counts)
+}
+
+func (s *spillPartitions) add(part int, mappings []KV) error {
+	enc := json.NewEncoder(s.writers[part])
+	for _, mapping := range mappings {
+		if err := enc.Encode(mapping); err != nil {
+			return fmt.Errorf("spilling mappings: %w", err)
+		}
+	}
+	s.counts[part] += len(mappings)
+	return nil
+}
+
+// read reads a part back from its file. Parts can be read concurrently, but
+// not while mappings are added.
+func (s *spillPartitions) read(part int) ([]KV, error) {
+	if err := s.writers[part].Flush(); err != nil {
+		return nil, fmt.Errorf("spilling mappings: %w", err)
+	}
+	f, err := os.Open(s.files[part].Name())
+	if err != nil {
+		return nil, fmt.Errorf("reading spilled mappings: %w", err)
+	}
+	defer f.Close()
+
+	mappings := make([]KV, 0, s.counts[part])
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var mapping KV
+		err := dec.Decode(&mapping)
+		if errors.Is(err, io.EOF) {
+			return mappings, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading spilled mappings: %w", err)
+		}
+		mappings = append(mappings, mapping)
+	}
+}
+
+func (s *spillPartitions) len(part int) int {
+	return s.counts[part]
+}
+
+func (s *spillPartitions) remove() error {
+	var errs []error
+	for _, f := range s.files {
+		errs = append(errs, f.Close(), os.Remove(f.Name()))
+	}
+	s.files, s.writers = nil, nil
+	return errors.Join(errs...)
+}
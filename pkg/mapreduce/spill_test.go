@@ -0,0 +1,63 @@
+package mapreduce
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_partitions(t *testing.T) {
+
+	mappings := make([]KV, 100)
+	for i := range mappings {
+		mappings[i] = KV{Key: "key" + strconv.Itoa(i%7), Value: json.RawMessage(strconv.Itoa(i))}
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+	}{
+		{name: "test memory"},
+		{name: "test spill", dir: t.TempDir()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := newPartitions(tt.dir, 3)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// the parts keep the order of the mappings
+			want := make([][]KV, 3)
+			for i, mapping := range mappings {
+				part := i % 3
+				assert.NoError(t, parts.add(part, []KV{mapping}))
+				want[part] = append(want[part], mapping)
+			}
+			assert.NoError(t, parts.add(2, nil))
+
+			assert.Equal(t, 3, parts.parts())
+			for part := range 3 {
+				assert.Equal(t, len(want[part]), parts.len(part))
+				got, err := parts.read(part)
+				if assert.NoError(t, err) {
+					assert.Equal(t, want[part], got)
+				}
+			}
+
+			assert.NoError(t, parts.remove())
+			if tt.dir != "" {
+				files, _ := os.ReadDir(tt.dir)
+				assert.Empty(t, files)
+			}
+		})
+	}
+}
+
+func Test_newPartitionsMissingDir(t *testing.T) {
+	_, err := newPartitions(t.TempDir()+"/missing", 2)
+	assert.ErrorContains(t, err, "creating spill file")
+}
@@ -0,0 +1,373 @@
+package mapreduce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/internal/metrics"
+	"github.com/FDeRubeis/mapreduce/internal/rpc"
+	"github.com/FDeRubeis/mapreduce/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// record formats of the HTTP transport
+const (
+	// ContentType is the format of the current release, where records are
+	// [key, value] pairs.
+	ContentType = kv.ContentType
+	// LegacyContentType is the format of the previous release, where
+	// records are JSON objects.
+	LegacyContentType = kv.LegacyContentType
+)
+
+// Local runs the tasks in process. Since a task gives the same result on
+// every attempt, its failures are permanent.
+type Local struct{}
+
+func (Local) Map(_ context.Context, task Task, content string) ([]KV, error) {
+	mappings, err := task.Job.RunMap(content, task.Params)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	return mappings, nil
+}
+
+func (Local) Shuffle(_ context.Context, _ Task, mappings []KV) (map[string][]json.RawMessage, error) {
+	return kv.Group(mappings), nil
+}
+
+func (Local) ShuffleReduce(_ context.Context, task Task, mappings []KV) (map[string]json.RawMessage, error) {
+	result, err := task.Job.RunReduce(kv.Group(mappings), task.Params)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	return result, nil
+}
+
+func (Local) Reduce(_ context.Context, task Task, groups map[string][]json.RawMessage) (map[string]json.RawMessage, error) {
+	result, err := task.Job.RunReduce(groups, task.Params)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	return result, nil
+}
+
+// HTTPTransport sends the tasks to the services as HTTP requests with JSON
+// bodies. Addresses are host:port pairs.
+type HTTPTransport struct {
+	// Format is the record format of the tasks, ContentType or
+	// LegacyContentType for workers of the previous release.
+	Format string
+
+	MapAddr string
+	// ShuffleAddrs are the addresses of the shuffle workers. Shuffle task i
+	// goes to worker i, and to the next worker on each retry.
+	ShuffleAddrs []string
+	ReduceAddr   string
+
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+func (t HTTPTransport) Map(ctx context.Context, task Task, content string) ([]KV, error) {
+
+	// send a task to the map service
+	task.Phase = MapPhase
+	url := taskURL(t.MapAddr, task.Params)
+	body, contentType, err := t.postTask(ctx, task, url, "text/plain", []byte(content), task.Attempt > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// get mappings from worker
+	return kv.UnmarshalPairs(body, kv.Format(contentType))
+}
+
+func (t HTTPTransport) Shuffle(ctx context.Context, task Task, mappings []KV) (map[string][]json.RawMessage, error) {
+
+	marshaled_task, err := kv.MarshalPairs(mappings, t.Format)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+
+	// send a task to the shuffle service
+	task.Phase = ShufflePhase
+	addr, err := shuffleAddr(t.ShuffleAddrs, task)
+	if err != nil {
+		return nil, err
+	}
+	body, contentType, err := t.postTask(ctx, task, taskURL(addr, task.Params), t.Format, marshaled_task, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// get shuffles from worker
+	return kv.UnmarshalGroups(body, kv.Format(contentType))
+}
+
+func (t HTTPTransport) ShuffleReduce(ctx context.Context, task Task, mappings []KV) (map[string]json.RawMessage, error) {
+
+	marshaled_task, err := kv.MarshalPairs(mappings, t.Format)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+
+	// send a task to the shuffle service, which reduces it too
+	task.Phase = ShufflePhase
+	addr, err := shuffleAddr(t.ShuffleAddrs, task)
+	if err != nil {
+		return nil, err
+	}
+	url := "http://" + addr + ShuffleReducePath + "?" + task.Params.Encode()
+	body, contentType, err := t.postTask(ctx, task, url, t.Format, marshaled_task, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// get final values
+	return kv.UnmarshalMap(body, kv.Format(contentType))
+}
+
+func (t HTTPTransport) Reduce(ctx context.Context, task Task, groups map[string][]json.RawMessage) (map[string]json.RawMessage, error) {
+
+	marshaled_task, err := kv.MarshalGroups(groups, t.Format)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+
+	// send a task to the reduce service
+	task.Phase = ReducePhase
+	url := taskURL(t.ReduceAddr, task.Params)
+	body, contentType, err := t.postTask(ctx, task, url, t.Format, marshaled_task, task.Attempt > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// get final values
+	return kv.UnmarshalMap(body, kv.Format(contentType))
+}
+
+// shuffleAddr returns the shuffle worker of a task: worker i for task i, and
+// the next worker on each retry.
+func shuffleAddr(addrs []string, task Task) (string, error) {
+	if len(addrs) == 0 {
+		return "", Permanent(errors.New("no shuffle workers"))
+	}
+	return addrs[(task.Index+task.Attempt)%len(addrs)], nil
+}
+
+func taskURL(addr string, params url.Values) string {
+	return "http://" + addr + "/?" + params.Encode()
+}
+
+// postTask sends the payload of a task to a worker and returns the body and
+// the content type of its answer. If newConn is set, the task is sent on a new
+// connection rather than on an idle one of the client, so that a load
+// balanced service can route it to a different worker. The service may still
+// route it to the same worker.
+func (t HTTPTransport) postTask(ctx context.Context, task Task, url string, contentType string, payload []byte, newConn bool) (body []byte, respType string, err error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, "", Permanent(err)
+	}
+
+	// the latency is recorded by the name of the worker that served the
+	// task, behind the load balancing of the service, or by the address of
+	// the service if the worker does not name itself
+	worker := req.URL.Host
+	defer observeTask(ctx, task.Phase, &worker, time.Now(), &err)
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", t.Format)
+	tracing.InjectHTTP(ctx, req.Header)
+	logging.SetHeaders(req.Header, task.JobID, task.ID(), task.Attempt)
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if newConn {
+		client = newConnClient(client)
+		req.Close = true
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if name := resp.Header.Get(logging.WorkerHeader); name != "" {
+		worker = name
+	}
+
+	// read response
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("worker answered %s", resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return nil, "", Permanent(err)
+		}
+		return nil, "", err
+	}
+
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// newConnClient returns a client like c that dials a new connection for
+// each request: its transport keeps no idle connections, so it cannot pick
+// one up from an earlier request. Setting Close on the request is not
+// enough, since it only closes the connection after the request. A client
+// whose transport is not an *http.Transport is returned as is.
+func newConnClient(c *http.Client) *http.Client {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	base, ok := transport.(*http.Transport)
+	if !ok {
+		return c
+	}
+
+	fresh := base.Clone()
+	fresh.DisableKeepAlives = true
+	client := *c
+	client.Transport = fresh
+	return &client
+}
+
+// GRPCTransport streams the tasks to the services over gRPC. Each task is
+// sent on a new connection, so that the tasks are balanced across the
+// workers of a service. Addresses are host:port pairs.
+type GRPCTransport struct {
+	MapAddr string
+	// ShuffleAddrs are the addresses of the shuffle workers. Shuffle task i
+	// goes to worker i, and to the next worker on each retry.
+	ShuffleAddrs []string
+	ReduceAddr   string
+
+	// DialOptions are added to the default options of the connections.
+	DialOptions []grpc.DialOption
+}
+
+func (t GRPCTransport) Map(ctx context.Context, task Task, content string) (_ []KV, err error) {
+	task.Phase = MapPhase
+	var header metadata.MD
+	worker := t.MapAddr
+	defer observeTask(ctx, task.Phase, &worker, time.Now(), &err)
+	mappings, err := t.client(&header).Map(outgoingGRPC(ctx, task), t.MapAddr, task.Params, content)
+	worker = grpcWorker(header, t.MapAddr)
+	return mappings, grpcError(err)
+}
+
+func (t GRPCTransport) Shuffle(ctx context.Context, task Task, mappings []KV) (_ map[string][]json.RawMessage, err error) {
+	task.Phase = ShufflePhase
+	addr, err := shuffleAddr(t.ShuffleAddrs, task)
+	if err != nil {
+		return nil, err
+	}
+	var header metadata.MD
+	worker := addr
+	defer observeTask(ctx, task.Phase, &worker, time.Now(), &err)
+	shuffles, err := t.client(&header).Shuffle(outgoingGRPC(ctx, task), addr, task.Params, mappings)
+	worker = grpcWorker(header, addr)
+	return shuffles, grpcError(err)
+}
+
+func (t GRPCTransport) ShuffleReduce(ctx context.Context, task Task, mappings []KV) (_ map[string]json.RawMessage, err error) {
+	task.Phase = ShufflePhase
+	addr, err := shuffleAddr(t.ShuffleAddrs, task)
+	if err != nil {
+		return nil, err
+	}
+	var header metadata.MD
+	worker := addr
+	defer observeTask(ctx, task.Phase, &worker, time.Now(), &err)
+	result, err := t.client(&header).ShuffleReduce(outgoingGRPC(ctx, task), addr, task.Params, mappings)
+	worker = grpcWorker(header, addr)
+	return result, grpcError(err)
+}
+
+func (t GRPCTransport) Reduce(ctx context.Context, task Task, groups map[string][]json.RawMessage) (_ map[string]json.RawMessage, err error) {
+	task.Phase = ReducePhase
+	var header metadata.MD
+	worker := t.ReduceAddr
+	defer observeTask(ctx, task.Phase, &worker, time.Now(), &err)
+	result, err := t.client(&header).Reduce(outgoingGRPC(ctx, task), t.ReduceAddr, task.Params, groups)
+	worker = grpcWorker(header, t.ReduceAddr)
+	return result, grpcError(err)
+}
+
+// client returns the client of a single call, which stores the header
+// metadata of the call in header.
+func (t GRPCTransport) client(header *metadata.MD) *rpc.Client {
+	opts := append(slices.Clip(t.DialOptions), grpc.WithDefaultCallOptions(grpc.Header(header)))
+	return rpc.NewClient(opts...)
+}
+
+// grpcWorker returns the worker named in the header metadata of a call, or
+// the address of the call if the worker does not name itself.
+func grpcWorker(header metadata.MD, addr string) string {
+	if names := header.Get(logging.WorkerHeader); len(names) > 0 && names[0] != "" {
+		return names[0]
+	}
+	return addr
+}
+
+// outgoingGRPC returns the context of the gRPC calls of a task, whose
+// metadata carries the trace, the job and the task.
+func outgoingGRPC(ctx context.Context, task Task) context.Context {
+	return logging.OutgoingGRPC(tracing.OutgoingGRPC(ctx), task.JobID, task.ID(), task.Attempt)
+}
+
+// observeTask records the latency of a task request to a worker, started at
+// start, and the worker in the span of the task. A failure is wrapped in a
+// workerError, so that it is logged with the worker. worker and err are read
+// when the request is over.
+func observeTask(ctx context.Context, phase Phase, worker *string, start time.Time, err *error) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("mapreduce.worker", *worker))
+	metrics.WorkerRequestDuration.WithLabelValues(string(phase), *worker, metrics.Status(*err)).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		*err = &workerError{worker: *worker, err: *err}
+	}
+}
+
+// workerError is the failure of a task request to a worker.
+type workerError struct {
+	worker string
+	err    error
+}
+
+func (e *workerError) Error() string {
+	return e.err.Error()
+}
+
+func (e *workerError) Unwrap() error {
+	return e.err
+}
+
+// grpcError marks the tasks rejected by the worker as permanent failures.
+func grpcError(err error) error {
+	if status.Code(err) == codes.InvalidArgument {
+		return Permanent(err)
+	}
+	return err
+}
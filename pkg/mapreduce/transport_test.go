@@ -0,0 +1,465 @@
+package mapreduce
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+	"github.com/FDeRubeis/mapreduce/internal/metrics"
+	"github.com/FDeRubeis/mapreduce/internal/rpc"
+	"github.com/FDeRubeis/mapreduce/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func Test_HTTPTransport(t *testing.T) {
+
+	mapServer := httptest.NewServer(http.HandlerFunc(MapHandler))
+	defer mapServer.Close()
+	shuffleMux := http.NewServeMux()
+	shuffleMux.HandleFunc("/", ShuffleHandler)
+	shuffleMux.HandleFunc(ShuffleReducePath, ShuffleReduceHandler)
+	shuffleServer := httptest.NewServer(shuffleMux)
+	defer shuffleServer.Close()
+	reduceServer := httptest.NewServer(http.HandlerFunc(ReduceHandler))
+	defer reduceServer.Close()
+
+	// a worker that answers non-JSON gibberish
+	gibberishServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`blah blah`))
+	}))
+	defer gibberishServer.Close()
+
+	addr := func(server *httptest.Server) string {
+		return server.Listener.Addr().String()
+	}
+	transport := HTTPTransport{
+		Format:       ContentType,
+		MapAddr:      addr(mapServer),
+		ShuffleAddrs: []string{addr(shuffleServer), addr(shuffleServer)},
+		ReduceAddr:   addr(reduceServer),
+	}
+	legacy := transport
+	legacy.Format = LegacyContentType
+	badMap := transport
+	badMap.MapAddr = addr(gibberishServer)
+	badShuffle := transport
+	badShuffle.ShuffleAddrs = []string{addr(gibberishServer)}
+	badReduce := transport
+	badReduce.ReduceAddr = addr(gibberishServer)
+
+	tests := []struct {
+		name            string
+		transport       HTTPTransport
+		shuffleTasks    int
+		reduceInShuffle bool
+		wantErr         string
+	}{
+		{
+			name:         "test http transport",
+			transport:    transport,
+			shuffleTasks: 2,
+		},
+		{
+			name:         "test legacy wire format",
+			transport:    legacy,
+			shuffleTasks: 2,
+		},
+		{
+			name:            "test reduce in shuffle",
+			transport:       transport,
+			shuffleTasks:    2,
+			reduceInShuffle: true,
+		},
+		{
+			name:            "test legacy wire format reduce in shuffle",
+			transport:       legacy,
+			shuffleTasks:    2,
+			reduceInShuffle: true,
+		},
+		{
+			name:         "test gibberish map response",
+			transport:    badMap,
+			shuffleTasks: 2,
+			wantErr:      "map task 0 failed after 3 attempts: invalid character 'b' looking for beginning of value",
+		},
+		{
+			name:         "test gibberish shuffle response",
+			transport:    badShuffle,
+			shuffleTasks: 1,
+			wantErr:      "shuffle task 0 failed after 3 attempts: invalid character 'b' looking for beginning of value",
+		},
+		{
+			name:         "test gibberish reduce response",
+			transport:    badReduce,
+			shuffleTasks: 2,
+			wantErr:      "reduce task 0 failed after 3 attempts: invalid character 'b' looking for beginning of value",
+		},
+		{
+			name:            "test gibberish shuffle reduce response",
+			transport:       badShuffle,
+			shuffleTasks:    1,
+			reduceInShuffle: true,
+			wantErr:         "shuffle task 0 failed after 3 attempts: invalid character 'b' looking for beginning of value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &Engine{
+				Transport:       tt.transport,
+				ShuffleTasks:    tt.shuffleTasks,
+				ReduceTasks:     1,
+				ReduceInShuffle: tt.reduceInShuffle,
+				Retry:           RetryPolicy{MaxAttempts: 3},
+			}
+			j, _ := Lookup("")
+
+			got, err := engine.Run(context.Background(), j, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit"))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, wordCount, got)
+			}
+		})
+	}
+}
+
+func Test_postTask(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantBody      string
+		wantErr       string
+		wantPermanent bool
+	}{
+		{
+			name:     "test successful task",
+			status:   http.StatusOK,
+			wantBody: `{"lorem":3}`,
+		},
+		{
+			name:          "test rejected task",
+			status:        http.StatusBadRequest,
+			wantErr:       "worker answered 400 Bad Request",
+			wantPermanent: true,
+		},
+		{
+			name:    "test worker failure",
+			status:  http.StatusInternalServerError,
+			wantErr: "worker answered 500 Internal Server Error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"lorem":3}`))
+			}))
+			defer server.Close()
+
+			transport := HTTPTransport{Format: LegacyContentType}
+			got, _, err := transport.postTask(context.Background(), Task{Phase: MapPhase}, server.URL, "application/json", []byte(`{"lorem":[1,1,1]}`), false)
+			if tt.wantErr != "" {
+				assert.EqualErrorf(t, err, tt.wantErr, "postTask() = %v, want %q", err, tt.wantErr)
+				var perm *permanentError
+				assert.Equal(t, tt.wantPermanent, errors.As(err, &perm))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantBody, string(got))
+		})
+	}
+}
+
+func Test_postTaskNewConn(t *testing.T) {
+
+	// the server records the connection of each request
+	var conns []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conns = append(conns, r.RemoteAddr)
+		w.Write([]byte(`{"lorem":3}`))
+	}))
+	defer server.Close()
+
+	for _, client := range []*http.Client{nil, server.Client()} {
+		conns = nil
+		transport := HTTPTransport{Format: LegacyContentType, Client: client}
+		for _, newConn := range []bool{false, false, true, false} {
+			_, _, err := transport.postTask(context.Background(), Task{Phase: MapPhase}, server.URL, "text/plain", []byte("lorem"), newConn)
+			assert.NoError(t, err)
+		}
+
+		// the retry does not reuse the idle connection of the first
+		// requests, and leaves none behind
+		if assert.Len(t, conns, 4) {
+			assert.Equal(t, conns[0], conns[1])
+			assert.NotEqual(t, conns[1], conns[2])
+			assert.NotEqual(t, conns[2], conns[3])
+		}
+	}
+}
+
+func Test_GRPCTransport(t *testing.T) {
+
+	// serve the workers on an in-process connection
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	rpc.RegisterMapper(s)
+	rpc.RegisterShuffler(s)
+	rpc.RegisterReducer(s)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	transport := GRPCTransport{
+		MapAddr:      "127.0.0.1:9090",
+		ShuffleAddrs: []string{"127.0.0.1:9090", "127.0.0.2:9090"},
+		ReduceAddr:   "127.0.0.1:9090",
+		DialOptions: []grpc.DialOption{grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		})},
+	}
+
+	j, _ := Lookup("")
+	engine := &Engine{Transport: transport, ShuffleTasks: 2, ReduceTasks: 2, Retry: RetryPolicy{MaxAttempts: 3}}
+	got, err := engine.Run(context.Background(), j, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, wordCount, got)
+	}
+
+	// the shuffle workers reduce the groups
+	engine.ReduceInShuffle = true
+	got, err = engine.Run(context.Background(), j, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, wordCount, got)
+	}
+
+	// tasks rejected by the worker are not retried
+	grep, _ := Lookup("grep")
+	engine.Params = map[string][]string{"pattern": {"("}}
+	_, err = engine.Run(context.Background(), grep, strings.NewReader("lorem lorem"))
+	var perm *permanentError
+	assert.ErrorAs(t, err, &perm)
+}
+
+func Test_HTTPTransportTracing(t *testing.T) {
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	}()
+
+	mapServer := httptest.NewServer(tracing.Handler("map worker", http.HandlerFunc(MapHandler)))
+	defer mapServer.Close()
+	shuffleServer := httptest.NewServer(tracing.Handler("shuffle worker", http.HandlerFunc(ShuffleHandler)))
+	defer shuffleServer.Close()
+	reduceServer := httptest.NewServer(tracing.Handler("reduce worker", http.HandlerFunc(ReduceHandler)))
+	defer reduceServer.Close()
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+	engine := &Engine{
+		Transport: HTTPTransport{
+			Format:       ContentType,
+			MapAddr:      mapServer.Listener.Addr().String(),
+			ShuffleAddrs: []string{shuffleServer.Listener.Addr().String()},
+			ReduceAddr:   reduceServer.Listener.Addr().String(),
+		},
+		TaskBytes:    11,
+		ShuffleTasks: 1,
+		ReduceTasks:  1,
+	}
+	if _, err := engine.Run(context.Background(), j, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")); !assert.NoError(t, err) {
+		return
+	}
+
+	spans := exporter.GetSpans()
+	byID := map[trace.SpanID]tracetest.SpanStub{}
+	names := map[string]int{}
+	for _, span := range spans {
+		byID[span.SpanContext.SpanID()] = span
+		names[span.Name]++
+	}
+	assert.Equal(t, map[string]int{
+		"job":            1,
+		"map":            1,
+		"shuffle":        1,
+		"reduce":         1,
+		"map task":       3,
+		"shuffle task":   1,
+		"reduce task":    1,
+		"map worker":     3,
+		"shuffle worker": 1,
+		"reduce worker":  1,
+	}, names)
+
+	// one trace, where the workers continue the tasks
+	for _, span := range spans {
+		assert.Equal(t, spans[0].SpanContext.TraceID(), span.SpanContext.TraceID())
+		if phase, ok := strings.CutSuffix(span.Name, " worker"); ok {
+			assert.Equal(t, phase+" task", byID[span.Parent.SpanID()].Name)
+		}
+	}
+}
+
+func Test_HTTPTransportLogging(t *testing.T) {
+
+	hook := logtest.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	mapServer := httptest.NewServer(logging.Handler("map", http.HandlerFunc(MapHandler)))
+	defer mapServer.Close()
+	shuffleServer := httptest.NewServer(logging.Handler("shuffle", http.HandlerFunc(ShuffleHandler)))
+	defer shuffleServer.Close()
+	reduceServer := httptest.NewServer(logging.Handler("reduce", http.HandlerFunc(ReduceHandler)))
+	defer reduceServer.Close()
+
+	j, err := Lookup("")
+	if !assert.NoError(t, err) {
+		return
+	}
+	engine := &Engine{
+		Transport: HTTPTransport{
+			Format:       ContentType,
+			MapAddr:      mapServer.Listener.Addr().String(),
+			ShuffleAddrs: []string{shuffleServer.Listener.Addr().String()},
+			ReduceAddr:   reduceServer.Listener.Addr().String(),
+		},
+		TaskBytes:    11,
+		ShuffleTasks: 1,
+		ReduceTasks:  1,
+		JobID:        "c0ffee",
+	}
+	if _, err := engine.Run(context.Background(), j, strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")); !assert.NoError(t, err) {
+		return
+	}
+
+	// each task is logged by its worker with the job, and without the
+	// document
+	tasks := map[string]string{}
+	for _, entry := range hook.AllEntries() {
+		assert.Equal(t, "c0ffee", entry.Data[logging.JobField])
+		assert.Equal(t, 0, entry.Data[logging.AttemptField])
+		assert.NotEmpty(t, entry.Data[logging.WorkerField])
+		assert.NotContains(t, entry.Data, "snippet")
+		tasks[entry.Data[logging.TaskField].(string)] = entry.Data[logging.PhaseField].(string)
+	}
+	assert.Equal(t, map[string]string{
+		"map-0":     "map",
+		"map-1":     "map",
+		"map-2":     "map",
+		"shuffle-0": "shuffle",
+		"reduce-0":  "reduce",
+	}, tasks)
+}
+
+func Test_TransportWorkerLabel(t *testing.T) {
+
+	hostname, _ := os.Hostname()
+
+	// the HTTP workers name themselves in a header
+	named := httptest.NewServer(logging.Handler("map", http.HandlerFunc(MapHandler)))
+	defer named.Close()
+	unnamed := httptest.NewServer(http.HandlerFunc(MapHandler))
+	defer unnamed.Close()
+
+	// the gRPC workers name themselves in the header metadata
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(grpc.StreamInterceptor(logging.StreamInterceptor("map")))
+	rpc.RegisterMapper(s)
+	go s.Serve(lis)
+	defer s.Stop()
+	unnamedLis := bufconn.Listen(1024 * 1024)
+	unnamedServer := grpc.NewServer()
+	rpc.RegisterMapper(unnamedServer)
+	go unnamedServer.Serve(unnamedLis)
+	defer unnamedServer.Stop()
+	dial := func(lis *bufconn.Listener) []grpc.DialOption {
+		return []grpc.DialOption{grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		})}
+	}
+
+	tests := []struct {
+		name       string
+		transport  Transport
+		wantWorker string
+	}{
+		{
+			name:       "test http worker",
+			transport:  HTTPTransport{Format: ContentType, MapAddr: named.Listener.Addr().String()},
+			wantWorker: hostname,
+		},
+		{
+			name:       "test http worker without name",
+			transport:  HTTPTransport{Format: ContentType, MapAddr: unnamed.Listener.Addr().String()},
+			wantWorker: unnamed.Listener.Addr().String(),
+		},
+		{
+			name:       "test grpc worker",
+			transport:  GRPCTransport{MapAddr: "127.0.0.1:9090", DialOptions: dial(lis)},
+			wantWorker: hostname,
+		},
+		{
+			name:       "test grpc worker without name",
+			transport:  GRPCTransport{MapAddr: "127.0.0.2:9090", DialOptions: dial(unnamedLis)},
+			wantWorker: "127.0.0.2:9090",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := workerRequests(t, tt.wantWorker)
+
+			// a failed task is labeled too, and its error names the worker
+			task := Task{Params: url.Values{"job": {"grep"}}}
+			_, err := tt.transport.Map(context.Background(), task, "lorem ipsum")
+			var werr *workerError
+			if assert.ErrorAs(t, err, &werr) {
+				assert.Equal(t, tt.wantWorker, werr.worker)
+			}
+
+			task.Params.Set("pattern", "lorem")
+			_, err = tt.transport.Map(context.Background(), task, "lorem ipsum")
+			assert.NoError(t, err)
+
+			assert.Equal(t, before+2, workerRequests(t, tt.wantWorker))
+		})
+	}
+}
+
+// workerRequests returns the number of map task requests to the worker
+// recorded in the latency histogram.
+func workerRequests(t *testing.T, worker string) uint64 {
+	var requests uint64
+	for _, status := range []string{metrics.Succeeded, metrics.Failed} {
+		m := &dto.Metric{}
+		err := metrics.WorkerRequestDuration.WithLabelValues(string(MapPhase), worker, status).(prometheus.Metric).Write(m)
+		assert.NoError(t, err)
+		requests += m.GetHistogram().GetSampleCount()
+	}
+	return requests
+}
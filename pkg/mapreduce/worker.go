@@ -0,0 +1,246 @@
+package mapreduce
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/FDeRubeis/mapreduce/internal/job"
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"github.com/FDeRubeis/mapreduce/internal/logging"
+)
+
+// MapHandler serves the map tasks of the HTTP transport: it maps the document
+// in the body of a POST request with the job of its query parameters.
+func MapHandler(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		logger.Errorf("Request with method not allowed: %s", r.Method)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error reading request body: %s", err)
+		return
+	}
+
+	params := r.URL.Query()
+	j, err := job.Lookup(params.Get("job"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		logger.Errorf("Invalid job: %s", err)
+		return
+	}
+
+	// compute mappings
+	content := string(body)
+	pairs, err := j.RunMap(content, params)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		logger.Errorf("Error mapping content: %s", err)
+		return
+	}
+
+	// write response
+	format := kv.Negotiate(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", format)
+	wm_marshaled, err := kv.MarshalPairs(pairs, format)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error encoding mapping: %s", err)
+		return
+	}
+	if _, err := w.Write(wm_marshaled); err != nil {
+		logger.Errorf("Error writing response: %s", err)
+		return
+	}
+
+	logging.Snippet(logger, func() string { return content }).Infof("Successfully ran %s map on %d bytes", j.Name, len(body))
+
+}
+
+// ShuffleHandler serves the shuffle tasks of the HTTP transport: it groups by
+// key the mappings in the body of a POST request.
+func ShuffleHandler(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		logger.Errorf("Request with method not allowed: %s", r.Method)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error reading request body: %s", err)
+		return
+	}
+
+	mappings, err := kv.UnmarshalPairs(body, kv.Format(r.Header.Get("Content-Type")))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error decoding mappings: %s", err)
+		return
+	}
+
+	// compute shuffles
+	shuffles := kv.Group(mappings)
+
+	// write response
+	format := kv.Negotiate(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", format)
+	shfl_marshaled, err := kv.MarshalGroups(shuffles, format)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error encoding shuffles: %s", err)
+		return
+	}
+	if _, err := w.Write(shfl_marshaled); err != nil {
+		logger.Errorf("Error writing response: %s", err)
+		return
+	}
+
+	logging.Snippet(logger, func() string { return fmt.Sprintf("%s", mappings) }).Infof("Successfully shuffled %d mappings", len(mappings))
+
+}
+
+// ShuffleReducePath is the path of the shuffle service where
+// ShuffleReduceHandler serves.
+const ShuffleReducePath = "/reduce"
+
+// ShuffleReduceHandler serves the shuffle tasks of the HTTP transport whose
+// groups are reduced by the shuffle worker: it groups by key the mappings in
+// the body of a POST request, and computes the final value of each group with
+// the job of its query parameters.
+func ShuffleReduceHandler(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		logger.Errorf("Request with method not allowed: %s", r.Method)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error reading request body: %s", err)
+		return
+	}
+
+	j, ok := reduceJob(w, r)
+	if !ok {
+		return
+	}
+
+	mappings, err := kv.UnmarshalPairs(body, kv.Format(r.Header.Get("Content-Type")))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error decoding mappings: %s", err)
+		return
+	}
+
+	// compute shuffles and their final values
+	shuffles := kv.Group(mappings)
+	result, err := j.RunReduce(shuffles, r.URL.Query())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error reducing values: %s", err)
+		return
+	}
+
+	// write response
+	format := kv.Negotiate(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", format)
+	result_marshaled, err := kv.MarshalMap(result, format)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error encoding result: %s", err)
+		return
+	}
+	if _, err = w.Write(result_marshaled); err != nil {
+		logger.Errorf("Error writing response: %s", err)
+	}
+
+	logging.Snippet(logger, func() string { return fmt.Sprintf("%s", mappings) }).Infof("Successfully shuffled and ran %s reduce on %d keys", j.Name, len(shuffles))
+
+}
+
+// ReduceHandler serves the reduce tasks of the HTTP transport: it computes the
+// final values of the groups in the body of a POST request with the job of
+// its query parameters.
+func ReduceHandler(w http.ResponseWriter, r *http.Request) {
+
+	logger := logging.FromContext(r.Context())
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		logger.Errorf("Request with method not allowed: %s", r.Method)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error reading request body: %s", err)
+		return
+	}
+
+	j, ok := reduceJob(w, r)
+	if !ok {
+		return
+	}
+
+	shuffle, err := kv.UnmarshalGroups(body, kv.Format(r.Header.Get("Content-Type")))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error decoding JSON: %s", err)
+		return
+	}
+
+	// compute final values
+	result, err := j.RunReduce(shuffle, r.URL.Query())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error reducing values: %s", err)
+		return
+	}
+
+	// write response
+	format := kv.Negotiate(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", format)
+	result_marshaled, err := kv.MarshalMap(result, format)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Errorf("Error encoding result: %s", err)
+		return
+	}
+	if _, err = w.Write(result_marshaled); err != nil {
+		logger.Errorf("Error writing response: %s", err)
+	}
+
+	logging.Snippet(logger, func() string { return fmt.Sprintf("%s", shuffle) }).Infof("Successfully ran %s reduce on %d keys", j.Name, len(shuffle))
+
+}
+
+// reduceJob returns the job of a reduce request, whose parameters are checked
+// before the groups are reduced, so that a request that cannot succeed is
+// rejected and not retried. If they are invalid, it writes the error
+// response and returns false.
+func reduceJob(w http.ResponseWriter, r *http.Request) (*job.Job, bool) {
+
+	logger := logging.FromContext(r.Context())
+	j, err := job.Lookup(r.URL.Query().Get("job"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		logger.Errorf("Invalid job: %s", err)
+		return nil, false
+	}
+	if _, err := j.ParseTopK(r.URL.Query()); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		logger.Errorf("Invalid top-K query: %s", err)
+		return nil, false
+	}
+
+	return j, true
+}
@@ -0,0 +1,671 @@
+package mapreduce
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/FDeRubeis/mapreduce/internal/kv"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MapHandler(t *testing.T) {
+
+	type args struct {
+		r *http.Request
+		w *httptest.ResponseRecorder
+	}
+	tests := []struct {
+		name            string
+		args            args
+		wantStatus      int
+		wantHeader      http.Header
+		wantBodySuccess []map[string]int
+		wantBodyKV      string
+		wantBodyFailure string
+	}{
+		{
+			name: "test map handler",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			wantBodySuccess: []map[string]int{
+				{"lorem": 1},
+				{"lorem": 1},
+				{"lorem": 1},
+				{"ipsum": 1},
+				{"ipsum": 1},
+				{"sit": 1},
+			},
+		},
+		{
+			name: "test map handler wrong request method",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodGet,
+					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
+				},
+			},
+			wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Method Not Allowed\n",
+		},
+		{
+			name: "test map handler preprocessing",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("lorem Lorem\n{}{}}}lorEm ipsUm\nipsum!!!    sit%#$^")),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			wantBodySuccess: []map[string]int{
+				{"lorem": 1},
+				{"lorem": 1},
+				{"lorem": 1},
+				{"ipsum": 1},
+				{"ipsum": 1},
+				{"sit": 1},
+			},
+		},
+		{
+			name: "test map handler grep job",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "job=grep&pattern=^lorem&combine=true"},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("lorem ipsum\ndolor sit\nlorem ipsum\nipsum lorem")),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			wantBodySuccess: []map[string]int{
+				{"lorem ipsum": 2},
+			},
+		},
+		{
+			name: "test map handler combiner",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "combine=true"},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			wantBodySuccess: []map[string]int{
+				{"lorem": 3},
+				{"ipsum": 2},
+				{"sit": 1},
+			},
+		},
+		{
+			name: "test map handler kv format",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "combine=true"},
+					Header: http.Header{"Accept": []string{kv.ContentType}},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{kv.ContentType},
+			},
+			wantBodyKV: `[["ipsum",2],["lorem",3],["sit",1]]`,
+		},
+		{
+			name: "test map handler unknown job",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "job=unknown"},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("lorem lorem\nlorem ipsum\nipsum sit")),
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Bad Request\n",
+		},
+	}
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+			MapHandler(tt.args.w, tt.args.r)
+
+			assert.Equalf(t, tt.wantStatus, tt.args.w.Code, "MapHandler() = %d, expected status code: %d", tt.args.w.Code, tt.wantStatus)
+
+			if !reflect.DeepEqual(tt.args.w.Header(), tt.wantHeader) {
+				t.Errorf("MapHandler() = %v, want %v", tt.args.w.Header(), tt.wantHeader)
+			}
+
+			if tt.wantBodyKV != "" {
+				assert.Equal(t, tt.wantBodyKV, tt.args.w.Body.String())
+			} else if tt.args.w.Code == http.StatusOK {
+				response := []map[string]int{}
+				json.Unmarshal(tt.args.w.Body.Bytes(), &response)
+				if !slicesDeepEqual(response, tt.wantBodySuccess) {
+					t.Errorf("MapHandler() = %v, want %v", response, tt.wantBodySuccess)
+				}
+			} else {
+				response := tt.args.w.Body.String()
+				if !reflect.DeepEqual(response, tt.wantBodyFailure) {
+					t.Errorf("MapHandler() = %v, want %v", response, tt.wantBodyFailure)
+				}
+			}
+
+		})
+	}
+}
+
+func slicesDeepEqual(a, b []map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	visited := make([]bool, len(b))
+	for _, mapA := range a {
+		found := false
+		for i := 0; i < len(b); i++ {
+			if visited[i] {
+				continue
+			}
+			if reflect.DeepEqual(mapA, b[i]) {
+				visited[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_ShuffleHandler(t *testing.T) {
+	type args struct {
+		r *http.Request
+		w *httptest.ResponseRecorder
+	}
+	tests := []struct {
+		name            string
+		args            args
+		wantStatus      int
+		wantHeader      http.Header
+		wantBodySuccess map[string][]int
+		wantBodyKV      string
+		wantBodyFailure string
+	}{
+		{
+			name: "test shuffle handler",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("[{\"lorem\":1},{\"ipsum\":1},{\"lorem\":1},{\"lorem\":1},{\"ipsum\":1}]")),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			wantBodySuccess: map[string][]int{
+				"lorem": {1, 1, 1},
+				"ipsum": {1, 1},
+			},
+		},
+		{
+			name: "test shuffle handler kv format",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					Header: http.Header{
+						"Content-Type": []string{kv.ContentType},
+						"Accept":       []string{kv.ContentType},
+					},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader(`[["lorem",1],["ipsum",1],["lorem",2],["ipsum",1]]`)),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{kv.ContentType},
+			},
+			wantBodyKV: `[["ipsum",[1,1]],["lorem",[1,2]]]`,
+		},
+		{
+			name: "test shuffle wrong method",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					Method: http.MethodGet,
+					Body:   io.NopCloser(strings.NewReader("[{\"lorem\":1},{\"ipsum\":1},{\"lorem\":1},{\"lorem\":1},{\"ipsum\":1}]")),
+				},
+			},
+			wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Method Not Allowed\n",
+		},
+		{
+			name: "test shuffle bad input",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("this is bad input")),
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Internal Server Error\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ShuffleHandler(tt.args.w, tt.args.r)
+
+			assert.Equalf(t, tt.wantStatus, tt.args.w.Code, "ShuffleHandler() = %d, expected status code: %d", tt.args.w.Code, tt.wantStatus)
+
+			if !reflect.DeepEqual(tt.args.w.Header(), tt.wantHeader) {
+				t.Errorf("ShuffleHandler() = %v, want %v", tt.args.w.Header(), tt.wantHeader)
+			}
+
+			if tt.wantBodyKV != "" {
+				assert.Equal(t, tt.wantBodyKV, tt.args.w.Body.String())
+			} else if tt.args.w.Code == http.StatusOK {
+				response := map[string][]int{}
+				json.Unmarshal(tt.args.w.Body.Bytes(), &response)
+				if !reflect.DeepEqual(response, tt.wantBodySuccess) {
+					t.Errorf("ShuffleHandler() = %v, want %v", response, tt.wantBodySuccess)
+				}
+			} else {
+				response := tt.args.w.Body.String()
+				if !reflect.DeepEqual(response, tt.wantBodyFailure) {
+					t.Errorf("ShuffleHandler() = %v, want %v", response, tt.wantBodyFailure)
+				}
+			}
+
+		})
+	}
+}
+
+func Test_ShuffleReduceHandler(t *testing.T) {
+
+	type args struct {
+		r *http.Request
+		w *httptest.ResponseRecorder
+	}
+	tests := []struct {
+		name            string
+		args            args
+		wantStatus      int
+		wantHeader      http.Header
+		wantBodySuccess map[string]int
+		wantBodyKV      string
+		wantBodyFailure string
+	}{
+		{
+			name: "test shuffle reduce handler",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("[{\"lorem\":1},{\"ipsum\":1},{\"lorem\":2},{\"sit\":1},{\"ipsum\":1}]")),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			wantBodySuccess: map[string]int{
+				"lorem": 3,
+				"ipsum": 2,
+				"sit":   1,
+			},
+		},
+		{
+			name: "test shuffle reduce handler kv format",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL: &url.URL{},
+					Header: http.Header{
+						"Content-Type": []string{kv.ContentType},
+						"Accept":       []string{kv.ContentType},
+					},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader(`[["lorem",1],["ipsum",1],["lorem",2],["sit",1],["ipsum",1]]`)),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{kv.ContentType},
+			},
+			wantBodyKV: `[["ipsum",2],["lorem",3],["sit",1]]`,
+		},
+		{
+			name: "test shuffle reduce handler wrong request method",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodGet,
+					Body:   io.NopCloser(strings.NewReader("[{\"lorem\":1}]")),
+				},
+			},
+			wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Method Not Allowed\n",
+		},
+		{
+			name: "test shuffle reduce handler bad input formatting",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("[{\"lorem\":1},{\"ipsum\"")),
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Internal Server Error\n",
+		},
+		{
+			name: "test shuffle reduce handler unknown job",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "job=unknown"},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("[{\"lorem\":1}]")),
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Bad Request\n",
+		},
+		{
+			name: "test shuffle reduce handler invalid top",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "job=wordcount&top=all"},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("[{\"lorem\":1}]")),
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Bad Request\n",
+		},
+		{
+			name: "test shuffle reduce handler top of a job without counts",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "job=invertedindex&top=2"},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("[{\"lorem\":1}]")),
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Bad Request\n",
+		},
+	}
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			ShuffleReduceHandler(tt.args.w, tt.args.r)
+
+			assert.Equalf(t, tt.wantStatus, tt.args.w.Code, "ShuffleReduceHandler() = %d, expected status code: %d", tt.args.w.Code, tt.wantStatus)
+			assert.Equal(t, tt.wantHeader, tt.args.w.Header())
+
+			if tt.wantBodyKV != "" {
+				assert.Equal(t, tt.wantBodyKV, tt.args.w.Body.String())
+			} else if tt.args.w.Code == http.StatusOK {
+				response := map[string]int{}
+				json.Unmarshal(tt.args.w.Body.Bytes(), &response)
+				assert.Equal(t, tt.wantBodySuccess, response)
+			} else {
+				assert.Equal(t, tt.wantBodyFailure, tt.args.w.Body.String())
+			}
+
+		})
+	}
+}
+
+func Test_ReduceHandler(t *testing.T) {
+
+	type args struct {
+		r *http.Request
+		w *httptest.ResponseRecorder
+	}
+	tests := []struct {
+		name            string
+		args            args
+		wantStatus      int
+		wantHeader      http.Header
+		wantBodySuccess map[string]int
+		wantBodyKV      string
+		wantBodyFailure string
+	}{
+		{
+			name: "test reduce handler",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("{\"lorem\": [2, 1], \"ipsum\": [1, 1], \"sit\": [1]}")),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			wantBodySuccess: map[string]int{
+				"lorem": 3,
+				"ipsum": 2,
+				"sit":   1,
+			},
+		},
+		{
+			name: "test reduce handler kv format",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL: &url.URL{},
+					Header: http.Header{
+						"Content-Type": []string{kv.ContentType},
+						"Accept":       []string{kv.ContentType},
+					},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader(`[["lorem",[2,1]],["ipsum",[1,1]],["sit",[1]]]`)),
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"Content-Type": []string{kv.ContentType},
+			},
+			wantBodyKV: `[["ipsum",2],["lorem",3],["sit",1]]`,
+		},
+		{
+			name: "test reduce handler wrong request method",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodGet,
+					Body:   io.NopCloser(strings.NewReader("{\"lorem\": [2, 1], \"ipsum\": [1, 1], \"sit\": [1]}")),
+				},
+			},
+			wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Method Not Allowed\n",
+		},
+		{
+			name: "test map handler bad input formatting",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("rwbcs\"lorem\": [2cssc, 1], \"ipsum\": [1, 1]]], \"sit\": [1]}")),
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Internal Server Error\n",
+		},
+		{
+			name: "test reduce handler unknown job",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "job=unknown"},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("{\"lorem\": [2, 1], \"ipsum\": [1, 1], \"sit\": [1]}")),
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Bad Request\n",
+		},
+		{
+			name: "test reduce handler invalid top",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "job=wordcount&top=all"},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("{\"lorem\": [2, 1], \"ipsum\": [1, 1], \"sit\": [1]}")),
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Bad Request\n",
+		},
+		{
+			name: "test reduce handler top of a job without counts",
+			args: args{
+				w: httptest.NewRecorder(),
+				r: &http.Request{
+					URL:    &url.URL{RawQuery: "job=invertedindex&top=2"},
+					Method: http.MethodPost,
+					Body:   io.NopCloser(strings.NewReader("{\"lorem\": [2, 1], \"ipsum\": [1, 1], \"sit\": [1]}")),
+				},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantHeader: http.Header{
+				"Content-Type":           []string{"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": []string{"nosniff"},
+			},
+			wantBodyFailure: "Bad Request\n",
+		},
+	}
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			ReduceHandler(tt.args.w, tt.args.r)
+
+			assert.Equalf(t, tt.wantStatus, tt.args.w.Code, "ReduceHandler() = %d, expected status code: %d", tt.args.w.Code, tt.wantStatus)
+
+			if !reflect.DeepEqual(tt.args.w.Header(), tt.wantHeader) {
+				t.Errorf("ReduceHandler() = %v, want %v", tt.args.w.Header(), tt.wantHeader)
+			}
+
+			if tt.wantBodyKV != "" {
+				assert.Equal(t, tt.wantBodyKV, tt.args.w.Body.String())
+			} else if tt.args.w.Code == http.StatusOK {
+				response := map[string]int{}
+				json.Unmarshal(tt.args.w.Body.Bytes(), &response)
+				if !reflect.DeepEqual(response, tt.wantBodySuccess) {
+					t.Errorf("ReduceHandler() = %v, want %v", response, tt.wantBodySuccess)
+				}
+			} else {
+				response := tt.args.w.Body.String()
+				if !reflect.DeepEqual(response, tt.wantBodyFailure) {
+					t.Errorf("ReduceHandler() = %v, want %v", response, tt.wantBodyFailure)
+				}
+			}
+
+		})
+	}
+}